@@ -1,28 +1,133 @@
 package config
 
 import (
+	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+	"user-api/logging"
+	"user-api/services"
 	"user-api/tracing"
+	"user-api/utils"
 )
 
 // Config holds application configuration
 type Config struct {
-	Port        string
-	Environment string
-	Tracing     tracing.TracingConfig
+	Port               string
+	MaxConnections     int
+	ReadTimeout        time.Duration
+	WriteTimeout       time.Duration
+	IdleTimeout        time.Duration
+	BoltPath           string
+	TombstoneRetention time.Duration
+	PanicDetails       bool
+	Environment        string
+	ErrorFormat        string
+	BatchStatusMode    string
+	MaxQueryParams     int
+	MaxResponseBytes   int
+	MaxGzipBodyBytes   int
+	MaxJSONDepth       int
+	AcceptCamelCase    bool
+	NameFormat         string
+	NameSeparator      string
+	AllowJSONSubtypes  bool
+	NullOptionals      bool
+	ContentLengthCheck bool
+	MaxBodyBytes       int
+	IDPattern          string
+	IDChecksum         bool
+	RequiredHeaders    []string
+	KnownClients       []string
+	InflightHeader     bool
+	SafeMethodGuard    bool
+	IntegrityEndpoint  bool
+	DuplicatesEndpoint bool
+	SelfTestEndpoint   bool
+	DebugStatsEndpoint bool
+	WebSocketEnabled   bool
+	TrustedProxies     []string
+	IPAllowList        []string
+	IPDenyList         []string
+	APIVersions        []string
+	APIDefaultVersion  string
+	Tracing            tracing.TracingConfig
+	Logging            logging.LoggingConfig
+	Users              services.UserServiceConfig
 }
 
-// LoadConfig loads configuration from environment variables
-func LoadConfig() *Config {
+// LoadConfig loads configuration from environment variables, failing on settings that
+// must not fall back to a default
+func LoadConfig() (*Config, error) {
 	environment := getEnv("ENVIRONMENT", "development")
 
+	users, err := services.LoadUserServiceConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
 	config := &Config{
-		Port:        getEnv("PORT", "8080"),
-		Environment: environment,
-		Tracing:     tracing.LoadTracingConfigFromEnv(environment),
+		Port:               getEnv("PORT", "8080"),
+		MaxConnections:     getEnvInt("MAX_CONNECTIONS", 0),
+		ReadTimeout:        getEnvDuration("SERVER_READ_TIMEOUT", 15*time.Second),
+		WriteTimeout:       getEnvDuration("SERVER_WRITE_TIMEOUT", 15*time.Second),
+		IdleTimeout:        getEnvDuration("SERVER_IDLE_TIMEOUT", 60*time.Second),
+		BoltPath:           getEnv("BOLT_PATH", ""),
+		TombstoneRetention: getEnvDuration("TOMBSTONE_RETENTION", 30*24*time.Hour),
+		PanicDetails:       getEnvBool("PANIC_DETAILS", environment == "development"),
+		Environment:        environment,
+		ErrorFormat:        getEnv("ERROR_FORMAT", "envelope"),
+		BatchStatusMode:    getEnv("BATCH_STATUS_MODE", "multi_status"),
+		MaxQueryParams:     getEnvInt("MAX_QUERY_PARAMS", 20),
+		MaxResponseBytes:   getEnvInt("MAX_RESPONSE_BYTES", 10*1024*1024),
+		MaxGzipBodyBytes:   getEnvInt("MAX_GZIP_BODY_BYTES", 1024*1024),
+		MaxJSONDepth:       getEnvInt("MAX_JSON_DEPTH", utils.DefaultMaxJSONDepth),
+		AcceptCamelCase:    getEnvBool("ACCEPT_CAMEL_CASE", false),
+		NameFormat:         getEnv("NAME_FORMAT", "first_last"),
+		NameSeparator:      getEnv("NAME_SEPARATOR", " "),
+		AllowJSONSubtypes:  getEnvBool("ALLOW_JSON_SUBTYPES", false),
+		NullOptionals:      getEnvBool("NULL_OPTIONALS", false),
+		ContentLengthCheck: getEnvBool("CONTENT_LENGTH_CHECK", false),
+		MaxBodyBytes:       getEnvInt("MAX_BODY_BYTES", 1024*1024),
+		IDPattern:          getEnv("ID_PATTERN", ""),
+		IDChecksum:         getEnvBool("ID_CHECKSUM", false),
+		RequiredHeaders:    getEnvList("REQUIRED_HEADERS"),
+		KnownClients:       getEnvList("KNOWN_CLIENTS"),
+		InflightHeader:     getEnvBool("INFLIGHT_HEADER", false),
+		SafeMethodGuard:    getEnvBool("SAFE_METHOD_GUARD", false),
+		IntegrityEndpoint:  getEnvBool("INTEGRITY_ENDPOINT", false),
+		DuplicatesEndpoint: getEnvBool("DUPLICATES_ENDPOINT", false),
+		SelfTestEndpoint:   getEnvBool("SELFTEST_ENDPOINT", false),
+		DebugStatsEndpoint: getEnvBool("DEBUG_STATS_ENDPOINT", false),
+		WebSocketEnabled:   getEnvBool("WEBSOCKET_ENABLED", false),
+		TrustedProxies:     getEnvList("TRUSTED_PROXIES"),
+		IPAllowList:        getEnvList("IP_ALLOW_LIST"),
+		IPDenyList:         getEnvList("IP_DENY_LIST"),
+		APIVersions:        getEnvList("API_VERSIONS"),
+		APIDefaultVersion:  getEnv("API_DEFAULT_VERSION", "1"),
+		Tracing:            tracing.LoadTracingConfigFromEnv(environment),
+		Logging:            logging.LoadLoggingConfigFromEnv(environment),
+		Users:              users,
+	}
+
+	// Panic internals and debug stats are never exposed, and self-test users never
+	// written, in production
+	if environment == "production" {
+		config.PanicDetails = false
+		config.SelfTestEndpoint = false
+		config.DebugStatsEndpoint = false
+	}
+
+	if len(config.TrustedProxies) == 0 {
+		config.TrustedProxies = []string{"127.0.0.1", "::1"}
 	}
 
-	return config
+	if len(config.APIVersions) == 0 {
+		config.APIVersions = []string{config.APIDefaultVersion}
+	}
+
+	return config, nil
 }
 
 // getEnv gets an environment variable with a default value
@@ -32,3 +137,56 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt gets an integer environment variable with a default value
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid value for %s: %q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvDuration gets a duration environment variable such as "10s" with a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		log.Printf("Invalid value for %s: %q, using default %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvBool gets a boolean environment variable with a default value
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid value for %s: %q, using default %t", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvList gets a comma-separated environment variable as a list, skipping empty entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
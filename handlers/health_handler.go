@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+	"user-api/health"
+	"user-api/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// checkTimeout bounds how long readiness waits for dependency checks
+const checkTimeout = 2 * time.Second
+
+// HealthHandler handles HTTP requests for readiness probes
+type HealthHandler struct {
+	readiness *health.Readiness
+	checks    *health.Registry
+	tracer    trace.Tracer
+}
+
+// NewHealthHandler creates a new health handler that also runs the registered
+// dependency checks; checks may be nil
+func NewHealthHandler(readiness *health.Readiness, checks *health.Registry) *HealthHandler {
+	if checks == nil {
+		checks = health.NewRegistry()
+	}
+	return &HealthHandler{
+		readiness: readiness,
+		checks:    checks,
+		tracer:    tracing.GetTracer("user-api/handlers"),
+	}
+}
+
+// Readiness handles GET /readyz
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	ctx, span := startHandlerSpan(c, h.tracer)
+	defer span.End()
+
+	state := h.readiness.State()
+	tracing.AddSpanAttributes(span, attribute.String("readiness.state", string(state)))
+
+	if state != health.StateReady {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":  "error",
+			"message": "Server is not ready",
+			"state":   state,
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	checks, healthy := h.checks.CheckAll(ctx)
+	tracing.AddSpanAttributes(span, attribute.Bool("readiness.checks_passed", healthy))
+
+	if !healthy {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":  "error",
+			"message": "Dependency checks failed",
+			"state":   state,
+			"checks":  checks,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Server is ready",
+		"state":   state,
+		"checks":  checks,
+	})
+}
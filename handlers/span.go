@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"strings"
+	"user-api/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HandlerSpanName derives a span name from the Gin handler serving the request,
+// e.g. "user-api/handlers.(*UserHandler).CreateUser-fm" becomes "CreateUser"
+func HandlerSpanName(c *gin.Context) string {
+	handler := c.Handler()
+	if handler == nil {
+		return c.FullPath()
+	}
+
+	fn := runtime.FuncForPC(reflect.ValueOf(handler).Pointer())
+	if fn == nil {
+		return c.FullPath()
+	}
+
+	name := fn.Name()
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, "-fm")
+}
+
+// startHandlerSpan starts a span named after the current handler and attaches it to the request.
+// Handlers that need a different name can call tracing.StartSpan directly.
+func startHandlerSpan(c *gin.Context, tracer trace.Tracer) (context.Context, trace.Span) {
+	ctx, span := tracing.StartSpan(c.Request.Context(), tracer, HandlerSpanName(c))
+
+	// Update context in gin
+	c.Request = c.Request.WithContext(ctx)
+
+	return ctx, span
+}
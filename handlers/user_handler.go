@@ -1,9 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 	"user-api/models"
+	"user-api/repository"
 	"user-api/services"
 	"user-api/tracing"
 	"user-api/utils"
@@ -13,10 +21,17 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
+// maxBulkItems is the maximum number of users accepted in a single bulk request
+const maxBulkItems = 100
+
 // UserHandler handles HTTP requests for user operations
 type UserHandler struct {
 	userService *services.UserService
 	tracer      trace.Tracer
+
+	// shutdown is closed to end long-lived event streams when the server stops
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
 }
 
 // NewUserHandler creates a new user handler
@@ -24,21 +39,19 @@ func NewUserHandler(userService *services.UserService) *UserHandler {
 	return &UserHandler{
 		userService: userService,
 		tracer:      tracing.GetTracer("user-api/handlers"),
+		shutdown:    make(chan struct{}),
 	}
 }
 
 // CreateUser handles POST /api/users
 func (h *UserHandler) CreateUser(c *gin.Context) {
-	ctx, span := tracing.StartSpan(c.Request.Context(), h.tracer, "CreateUser")
+	ctx, span := startHandlerSpan(c, h.tracer)
 	defer span.End()
 
-	// Update context in gin
-	c.Request = c.Request.WithContext(ctx)
-
 	var req models.CreateUserRequest
 
 	// Bind JSON request to struct
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := utils.BindJSON(c, &req); err != nil {
 		tracing.RecordError(span, err)
 		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
 		utils.ValidationErrorResponse(c, err)
@@ -52,24 +65,33 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		attribute.String("user.last_name", req.LastName),
 	)
 
-	// Trim whitespace from string fields
-	req.FirstName = strings.TrimSpace(req.FirstName)
-	req.LastName = strings.TrimSpace(req.LastName)
-	req.Email = strings.TrimSpace(req.Email)
-	req.Phone = strings.TrimSpace(req.Phone)
-	req.DateOfBirth = strings.TrimSpace(req.DateOfBirth)
+	// Conditional create returns the existing user instead of a conflict
+	if isConditionalCreate(c) {
+		h.getOrCreateUser(ctx, c, span, req)
+		return
+	}
 
 	// Create user through service
-	user, err := h.userService.CreateUser(ctx, req)
+	user, transformations, err := h.userService.CreateUserWithTransformations(ctx, req)
 	if err != nil {
 		tracing.RecordError(span, err)
 
-		if strings.Contains(err.Error(), "already exists") {
+		if handleContextError(c, span, err) {
+			return
+		}
+
+		if errors.Is(err, repository.ErrDuplicateEmail) {
 			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("conflict_error"))
 			utils.ConflictResponse(c, "User creation failed", err)
 			return
 		}
-		if strings.Contains(err.Error(), "required") || strings.Contains(err.Error(), "invalid") {
+		if errors.Is(err, services.ErrDomainRateLimited) {
+			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("rate_limited"))
+			utils.TooManyRequestsResponse(c, "User creation failed", err)
+			return
+		}
+		var validationErr *services.ValidationError
+		if errors.As(err, &validationErr) || strings.Contains(err.Error(), "required") || strings.Contains(err.Error(), "invalid") {
 			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
 			utils.ValidationErrorResponse(c, err)
 			return
@@ -90,27 +112,265 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		tracing.AttrUserEmail.String(user.Email),
 	)
 
-	// Return success response
+	// Return success response, listing applied normalizations when requested
+	response := user.ToResponse()
+	if h.userService.EchoTransformations() || isVerbose(c) {
+		response.Transformations = transformations
+	}
+	utils.CreatedResponse(c, "User created successfully", response)
+}
+
+// getOrCreateUser serves a conditional create, returning 201 for a new user and
+// 200 with the stored user when the email already exists
+func (h *UserHandler) getOrCreateUser(ctx context.Context, c *gin.Context, span trace.Span, req models.CreateUserRequest) {
+	user, created, err := h.userService.GetOrCreate(ctx, req)
+	if err != nil {
+		tracing.RecordError(span, err)
+		if handleContextError(c, span, err) {
+			return
+		}
+		if errors.Is(err, services.ErrDomainRateLimited) {
+			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("rate_limited"))
+			utils.TooManyRequestsResponse(c, "User creation failed", err)
+			return
+		}
+		var validationErr *services.ValidationError
+		if errors.As(err, &validationErr) {
+			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
+			utils.ValidationErrorResponse(c, err)
+			return
+		}
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("internal_error"))
+		utils.InternalServerErrorResponse(c, "Failed to create user", err)
+		return
+	}
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrUserID.String(user.ID),
+		attribute.Bool("user.already_existed", !created),
+		attribute.String("operation.result", "success"),
+	)
+
+	if !created {
+		utils.OKResponse(c, "User already exists", user.ToResponse())
+		return
+	}
+	tracing.AddSpanEvent(span, "user.created",
+		tracing.AttrUserID.String(user.ID),
+		tracing.AttrUserEmail.String(user.Email),
+	)
 	utils.CreatedResponse(c, "User created successfully", user.ToResponse())
 }
 
+// UpdateUser handles PUT /api/users/:id
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	ctx, span := startHandlerSpan(c, h.tracer)
+	defer span.End()
+
+	id := c.Param("id")
+	tracing.AddSpanAttributes(span, tracing.AttrUserID.String(id))
+
+	var req models.UpdateUserRequest
+
+	// Bind JSON request to struct
+	if err := utils.BindJSON(c, &req); err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	user, err := h.userService.UpdateUser(ctx, id, req)
+	if err != nil {
+		tracing.RecordError(span, err)
+
+		if handleContextError(c, span, err) {
+			return
+		}
+
+		var validationErr *services.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
+			utils.ValidationErrorResponse(c, err)
+		case strings.Contains(err.Error(), "not found"):
+			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("not_found"))
+			utils.NotFoundResponse(c, "User not found")
+		case errors.Is(err, repository.ErrDuplicateEmail):
+			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("conflict_error"))
+			utils.ConflictResponse(c, "User update failed", err)
+		default:
+			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("internal_error"))
+			utils.InternalServerErrorResponse(c, "Failed to update user", err)
+		}
+		return
+	}
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrUserEmail.String(user.Email),
+		attribute.String("operation.result", "success"),
+	)
+	tracing.AddSpanEvent(span, "user.updated", tracing.AttrUserID.String(user.ID))
+
+	utils.OKResponse(c, "User updated successfully", user.ToResponse())
+}
+
+// BulkUpsertUsers handles PUT /api/users/bulk
+func (h *UserHandler) BulkUpsertUsers(c *gin.Context) {
+	ctx, span := startHandlerSpan(c, h.tracer)
+	defer span.End()
+
+	var reqs []models.CreateUserRequest
+
+	// Bind JSON request to slice
+	if err := utils.BindJSON(c, &reqs); err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	if len(reqs) == 0 || len(reqs) > maxBulkItems {
+		err := fmt.Errorf("bulk request must contain between 1 and %d users", maxBulkItems)
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	results, err := h.userService.BulkUpsertUsers(ctx, reqs)
+	if err != nil {
+		tracing.RecordError(span, err)
+		if handleContextError(c, span, err) {
+			return
+		}
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("internal_error"))
+		utils.InternalServerErrorResponse(c, "Failed to process bulk upsert", err)
+		return
+	}
+
+	summary := utils.Summary{}
+	for _, result := range results {
+		if result.Status == models.BulkStatusError {
+			summary.Failed++
+		} else {
+			summary.Succeeded++
+		}
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("bulk.size", len(reqs)),
+		attribute.Int("bulk.failed", summary.Failed),
+		attribute.String("operation.result", "success"),
+	)
+
+	utils.MultiStatusResponse(c, "Bulk upsert processed", results, summary)
+}
+
+// getUserIDs writes a page of user IDs for GET /api/users?format=ids
+func (h *UserHandler) getUserIDs(ctx context.Context, c *gin.Context, span trace.Span, page, limit int) {
+	ids, total, err := h.userService.ListUserIDs(ctx, page, limit)
+	if err != nil {
+		tracing.RecordError(span, err)
+		if handleContextError(c, span, err) {
+			return
+		}
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("internal_error"))
+		utils.InternalServerErrorResponse(c, "Failed to get user IDs", err)
+		return
+	}
+
+	externalIDs := make([]string, len(ids))
+	for i, id := range ids {
+		externalIDs[i] = models.ExternalID(id)
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.String("response.format", "ids"),
+		attribute.Int("users.count", len(ids)),
+		attribute.Int("users.total", total),
+		attribute.String("operation.result", "success"),
+	)
+
+	utils.PaginatedResponse(c, "User IDs retrieved successfully", externalIDs, utils.NewPagination(page, limit, total))
+}
+
+// ValidateUsers handles POST /api/users/validate
+func (h *UserHandler) ValidateUsers(c *gin.Context) {
+	ctx, span := startHandlerSpan(c, h.tracer)
+	defer span.End()
+
+	var reqs []models.CreateUserRequest
+
+	// Bind JSON request to slice
+	if err := utils.BindJSON(c, &reqs); err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	if len(reqs) == 0 || len(reqs) > maxBulkItems {
+		err := fmt.Errorf("validation request must contain between 1 and %d users", maxBulkItems)
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	results, err := h.userService.ValidateUsers(ctx, reqs)
+	if err != nil {
+		tracing.RecordError(span, err)
+		if handleContextError(c, span, err) {
+			return
+		}
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("internal_error"))
+		utils.InternalServerErrorResponse(c, "Failed to validate users", err)
+		return
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("batch.size", len(reqs)),
+		attribute.String("operation.result", "success"),
+	)
+
+	utils.OKResponse(c, "Validation completed", results)
+}
+
 // GetUser handles GET /api/users/:id
 func (h *UserHandler) GetUser(c *gin.Context) {
-	ctx, span := tracing.StartSpan(c.Request.Context(), h.tracer, "GetUser")
+	ctx, span := startHandlerSpan(c, h.tracer)
 	defer span.End()
 
-	// Update context in gin
-	c.Request = c.Request.WithContext(ctx)
-
 	id := c.Param("id")
 
 	// Add request attributes
 	tracing.AddSpanAttributes(span, tracing.AttrUserID.String(id))
 
+	loc, err := parseTimezone(c)
+	if err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	nameFormat, err := parseNameFormat(c)
+	if err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
 	user, err := h.userService.GetUserByID(ctx, id)
 	if err != nil {
 		tracing.RecordError(span, err)
 
+		if handleContextError(c, span, err) {
+			return
+		}
+
 		if strings.Contains(err.Error(), "not found") {
 			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("not_found"))
 			utils.NotFoundResponse(c, "User not found")
@@ -127,48 +387,247 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 		attribute.String("operation.result", "success"),
 	)
 
-	utils.OKResponse(c, "User retrieved successfully", user.ToResponse())
+	response := user.ToResponse().InLocation(loc)
+	if nameFormat != "" {
+		response = response.WithNameFormat(nameFormat)
+	}
+	utils.OKResponse(c, "User retrieved successfully", response)
 }
 
 // GetUsers handles GET /api/users
 func (h *UserHandler) GetUsers(c *gin.Context) {
-	ctx, span := tracing.StartSpan(c.Request.Context(), h.tracer, "GetUsers")
+	ctx, span := startHandlerSpan(c, h.tracer)
 	defer span.End()
 
-	// Update context in gin
-	c.Request = c.Request.WithContext(ctx)
+	// Routes registered without the ListParams middleware parse their own parameters
+	params, ok := utils.GetListParams(c)
+	if !ok {
+		var err error
+		if params, err = utils.ParseListParams(c); err != nil {
+			tracing.RecordError(span, err)
+			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
+			utils.ValidationErrorResponse(c, err)
+			return
+		}
+	}
+	page, limit, since := params.Page, params.Limit, params.ChangedSince
 
-	users, err := h.userService.GetAllUsers(ctx)
+	loc, err := parseTimezone(c)
 	if err != nil {
 		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	nameFormat, err := parseNameFormat(c)
+	if err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	// IDs-only listing skips building full responses
+	if params.Format == utils.ListFormatIDs {
+		h.getUserIDs(ctx, c, span, page, limit)
+		return
+	}
+
+	var users []*models.User
+	var total int
+	if since.IsZero() {
+		users, total, err = h.userService.ListUsers(ctx, page, limit)
+	} else {
+		users, total, err = h.userService.ListUsersChangedSince(ctx, since, page, limit)
+	}
+	if err != nil {
+		tracing.RecordError(span, err)
+		if handleContextError(c, span, err) {
+			return
+		}
 		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("internal_error"))
 		utils.InternalServerErrorResponse(c, "Failed to get users", err)
 		return
 	}
 
-	// Convert users to response format
-	var userResponses []models.UserResponse
+	// Convert users to response format, always serializing as an array
+	userResponses := make([]models.UserResponse, 0, len(users))
 	for _, user := range users {
-		userResponses = append(userResponses, user.ToResponse())
+		response := user.ToResponse().InLocation(loc)
+		if nameFormat != "" {
+			response = response.WithNameFormat(nameFormat)
+		}
+		userResponses = append(userResponses, response)
 	}
 
 	// Add success attributes
 	tracing.AddSpanAttributes(span,
 		attribute.Int("users.count", len(users)),
+		attribute.Int("users.total", total),
 		attribute.String("operation.result", "success"),
 	)
 
-	utils.OKResponse(c, "Users retrieved successfully", userResponses)
+	utils.PaginatedResponse(c, "Users retrieved successfully", userResponses, utils.NewPagination(page, limit, total))
+}
+
+// StreamUserEvents handles GET /api/users/events, streaming user changes as server-sent events
+// until the client disconnects
+func (h *UserHandler) StreamUserEvents(c *gin.Context) {
+	ctx, span := startHandlerSpan(c, h.tracer)
+	defer span.End()
+
+	events, unsubscribe := h.userService.SubscribeUserEvents()
+	defer unsubscribe()
+
+	// The stream outlives the server's write timeout; lift it where the writer allows
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	sent := 0
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+			sent++
+			return true
+		case <-h.shutdown:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	})
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("events.sent", sent),
+		attribute.String("operation.result", "success"),
+	)
+}
+
+// FindDuplicates handles GET /api/users/duplicates
+func (h *UserHandler) FindDuplicates(c *gin.Context) {
+	ctx, span := startHandlerSpan(c, h.tracer)
+	defer span.End()
+
+	groups, err := h.userService.FindDuplicates(ctx)
+	if err != nil {
+		tracing.RecordError(span, err)
+		if handleContextError(c, span, err) {
+			return
+		}
+		if errors.Is(err, services.ErrDuplicateScanTooLarge) {
+			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
+			utils.ErrorResponse(c, http.StatusUnprocessableEntity, "Too many users to scan for duplicates", err)
+			return
+		}
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("internal_error"))
+		utils.InternalServerErrorResponse(c, "Failed to find duplicate users", err)
+		return
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("duplicates.groups", len(groups)),
+		attribute.String("operation.result", "success"),
+	)
+
+	utils.OKResponse(c, "Duplicate users retrieved successfully", groups)
+}
+
+// GetUserSchema handles GET /api/users/schema
+func (h *UserHandler) GetUserSchema(c *gin.Context) {
+	_, span := startHandlerSpan(c, h.tracer)
+	defer span.End()
+
+	tracing.AddSpanAttributes(span, attribute.String("operation.result", "success"))
+	utils.OKResponse(c, "User schema retrieved successfully", models.CreateUserRequestSchema())
+}
+
+// DebugStats handles GET /debug/stats
+func (h *UserHandler) DebugStats(c *gin.Context) {
+	ctx, span := startHandlerSpan(c, h.tracer)
+	defer span.End()
+
+	stats, err := h.userService.GetRepositoryStats(ctx)
+	if err != nil {
+		tracing.RecordError(span, err)
+		if handleContextError(c, span, err) {
+			return
+		}
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("internal_error"))
+		utils.InternalServerErrorResponse(c, "Failed to get repository stats", err)
+		return
+	}
+
+	tracing.AddSpanAttributes(span, attribute.String("operation.result", "success"))
+	utils.OKResponse(c, "Repository stats retrieved successfully", struct {
+		repository.RepoStats
+		ValidationFailures map[string]int64 `json:"validation_failures"`
+	}{
+		RepoStats:          stats,
+		ValidationFailures: h.userService.ValidationFailureCounts(),
+	})
+}
+
+// VerifyIntegrity handles GET /admin/integrity, and POST /admin/integrity/repair which
+// rebuilds repository indexes before reporting the problems that remain
+func (h *UserHandler) VerifyIntegrity(c *gin.Context) {
+	ctx, span := startHandlerSpan(c, h.tracer)
+	defer span.End()
+
+	repair := c.Request.Method == http.MethodPost
+	problems, err := h.userService.CheckIntegrity(ctx, repair)
+	if err != nil {
+		tracing.RecordError(span, err)
+		if handleContextError(c, span, err) {
+			return
+		}
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("internal_error"))
+		utils.InternalServerErrorResponse(c, "Failed to check repository integrity", err)
+		return
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("integrity.problems", len(problems)),
+		attribute.String("operation.result", "success"),
+	)
+	utils.OKResponse(c, "Repository integrity checked", gin.H{
+		"consistent": len(problems) == 0,
+		"repaired":   repair,
+		"problems":   problems,
+	})
+}
+
+// SelfTest handles GET /api/selftest, running a throwaway user through create, read,
+// update, and delete. It responds 200 when every step succeeds and 503 otherwise.
+func (h *UserHandler) SelfTest(c *gin.Context) {
+	ctx, span := startHandlerSpan(c, h.tracer)
+	defer span.End()
+
+	report := h.userService.RunSelfTest(ctx)
+	tracing.AddSpanAttributes(span, attribute.Bool("selftest.success", report.Success))
+	if !report.Success {
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("selftest_failed"))
+		utils.ErrorResponseWithData(c, http.StatusServiceUnavailable, "Self-test failed", nil, report)
+		return
+	}
+
+	tracing.AddSpanAttributes(span, attribute.String("operation.result", "success"))
+	utils.OKResponse(c, "Self-test passed", report)
 }
 
 // HealthCheck handles GET /health
 func (h *UserHandler) HealthCheck(c *gin.Context) {
-	ctx, span := tracing.StartSpan(c.Request.Context(), h.tracer, "HealthCheck")
+	ctx, span := startHandlerSpan(c, h.tracer)
 	defer span.End()
 
-	// Update context in gin
-	c.Request = c.Request.WithContext(ctx)
-
 	traceID := tracing.GetTraceID(ctx)
 
 	response := gin.H{
@@ -185,3 +644,61 @@ func (h *UserHandler) HealthCheck(c *gin.Context) {
 
 	c.JSON(http.StatusOK, response)
 }
+
+// handleContextError responds with 499 when the client went away mid-request and
+// 504 when a repository call ran past its deadline. It reports whether the error was handled.
+func handleContextError(c *gin.Context, span trace.Span, err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled):
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("client_closed"))
+		utils.ClientClosedResponse(c)
+	case errors.Is(err, services.ErrRepositoryTimeout):
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("repository_timeout"))
+		utils.GatewayTimeoutResponse(c, "Repository timed out", err)
+	default:
+		return false
+	}
+	return true
+}
+
+// parseTimezone resolves the optional tz query parameter, defaulting to UTC
+func parseTimezone(c *gin.Context) (*time.Location, error) {
+	tz := c.Query("tz")
+	if tz == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil || tz == "Local" {
+		return nil, fmt.Errorf("tz must be a valid IANA time zone")
+	}
+	return loc, nil
+}
+
+// parseNameFormat reads the optional name_format query parameter, returning "" to keep
+// the configured default
+func parseNameFormat(c *gin.Context) (string, error) {
+	format := c.Query("name_format")
+	if format == "" {
+		return "", nil
+	}
+	if err := models.ValidateNameFormat(format); err != nil {
+		return "", fmt.Errorf("name_format: %w", err)
+	}
+	return format, nil
+}
+
+// isVerbose reports whether the client asked for verbose responses via ?verbose=true
+func isVerbose(c *gin.Context) bool {
+	verbose, err := strconv.ParseBool(c.Query("verbose"))
+	return err == nil && verbose
+}
+
+// isConditionalCreate reports whether the client asked for create-if-not-exists
+// via ?if_not_exists=true or If-None-Match: *
+func isConditionalCreate(c *gin.Context) bool {
+	if ifNotExists, err := strconv.ParseBool(c.Query("if_not_exists")); err == nil && ifNotExists {
+		return true
+	}
+	return strings.TrimSpace(c.GetHeader("If-None-Match")) == "*"
+}
@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"net/http"
+	"user-api/version"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Version handles GET /version
+func Version(c *gin.Context) {
+	c.JSON(http.StatusOK, version.Get())
+}
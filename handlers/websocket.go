@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"time"
+	"user-api/tracing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// WebSocket keepalive timing: the server pings every wsPingInterval and drops
+// clients that haven't answered within wsPongWait
+const (
+	wsPingInterval = 30 * time.Second
+	wsPongWait     = 60 * time.Second
+	wsWriteWait    = 10 * time.Second
+)
+
+// upgrader upgrades event stream requests; the default origin check only admits same-origin browsers
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// UserEventsWebSocket handles GET /api/users/ws, pushing user changes as JSON messages
+// over a WebSocket until the client disconnects or the server shuts down
+func (h *UserHandler) UserEventsWebSocket(c *gin.Context) {
+	ctx, span := startHandlerSpan(c, h.tracer)
+	defer span.End()
+
+	// Subscribe before upgrading so events published once the client sees the
+	// handshake complete are never missed
+	events, unsubscribe := h.userService.SubscribeUserEvents()
+	defer unsubscribe()
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already written an error response
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("websocket_upgrade"))
+		return
+	}
+	defer conn.Close()
+
+	// Read in the background so pongs and client close frames are processed
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	sent := 0
+	defer func() {
+		tracing.AddSpanAttributes(span,
+			attribute.Int("events.sent", sent),
+			attribute.String("operation.result", "success"),
+		)
+	}()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+			sent++
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		case <-h.shutdown:
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(wsWriteWait))
+			return
+		case <-closed:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Shutdown ends open event streams, sending WebSocket clients a going-away close frame
+func (h *UserHandler) Shutdown() {
+	h.shutdownOnce.Do(func() {
+		close(h.shutdown)
+	})
+}
@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"sync"
+)
+
+// Checker checks a single dependency
+type Checker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+// CheckFunc adapts a function to the Checker interface
+type CheckFunc struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// NewCheckFunc creates a named checker from a function
+func NewCheckFunc(name string, check func(ctx context.Context) error) CheckFunc {
+	return CheckFunc{name: name, check: check}
+}
+
+// Name returns the checker's name
+func (f CheckFunc) Name() string {
+	return f.name
+}
+
+// Check runs the check function
+func (f CheckFunc) Check(ctx context.Context) error {
+	return f.check(ctx)
+}
+
+// Check status values
+const (
+	CheckStatusOK    = "ok"
+	CheckStatusError = "error"
+)
+
+// CheckResult is the outcome of a single check
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Registry holds the checkers run by the readiness endpoint
+type Registry struct {
+	checkers []Checker
+	mutex    sync.RWMutex
+}
+
+// NewRegistry creates an empty checker registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a checker to the registry
+func (r *Registry) Register(checker Checker) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.checkers = append(r.checkers, checker)
+}
+
+// CheckAll runs every registered checker and reports per-check results
+// and whether all of them passed
+func (r *Registry) CheckAll(ctx context.Context) (map[string]CheckResult, bool) {
+	r.mutex.RLock()
+	checkers := append([]Checker(nil), r.checkers...)
+	r.mutex.RUnlock()
+
+	results := make(map[string]CheckResult, len(checkers))
+	healthy := true
+	for _, checker := range checkers {
+		if err := checker.Check(ctx); err != nil {
+			results[checker.Name()] = CheckResult{Status: CheckStatusError, Error: err.Error()}
+			healthy = false
+			continue
+		}
+		results[checker.Name()] = CheckResult{Status: CheckStatusOK}
+	}
+	return results, healthy
+}
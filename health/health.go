@@ -0,0 +1,64 @@
+package health
+
+import (
+	"fmt"
+	"sync"
+)
+
+// State represents the readiness state of the application
+type State string
+
+const (
+	StateStarting     State = "starting"
+	StateReady        State = "ready"
+	StateShuttingDown State = "shutting_down"
+)
+
+// Readiness tracks the application's readiness state
+type Readiness struct {
+	state State
+	mutex sync.RWMutex
+}
+
+// NewReadiness creates a readiness tracker in the starting state
+func NewReadiness() *Readiness {
+	return &Readiness{
+		state: StateStarting,
+	}
+}
+
+// State returns the current readiness state
+func (r *Readiness) State() State {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.state
+}
+
+// IsReady reports whether the application is ready to serve traffic
+func (r *Readiness) IsReady() bool {
+	return r.State() == StateReady
+}
+
+// SetReady transitions from starting to ready
+func (r *Readiness) SetReady() error {
+	return r.transition(StateStarting, StateReady)
+}
+
+// SetShuttingDown transitions to shutting_down from any other state
+func (r *Readiness) SetShuttingDown() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.state = StateShuttingDown
+}
+
+// transition moves to the next state if the current state matches
+func (r *Readiness) transition(from, to State) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.state != from {
+		return fmt.Errorf("invalid readiness transition from %s to %s", r.state, to)
+	}
+	r.state = to
+	return nil
+}
@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// LoggingConfig holds log output configuration
+type LoggingConfig struct {
+	Output         string // "stdout", "file"
+	FilePath       string
+	MaxSizeMB      int
+	MaxAgeDays     int
+	MaxBackups     int
+	Compress       bool
+	RotateInterval time.Duration // 0 disables time-based rotation
+	IncludeSampled bool          // add sampled=true/false to request logs
+	SampleRate     *float64      // fraction of fast 2xx requests logged; nil logs all, 0 logs none
+	SlowThreshold  time.Duration // requests at least this slow are always logged
+}
+
+// InitLogging directs the standard logger to the configured destination
+func InitLogging(config LoggingConfig) (func() error, error) {
+	switch config.Output {
+	case "stdout":
+		log.SetOutput(os.Stdout)
+		return func() error { return nil }, nil
+
+	case "file":
+		if config.FilePath == "" {
+			return nil, fmt.Errorf("log file path is required for file output")
+		}
+		if err := os.MkdirAll(filepath.Dir(config.FilePath), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create log directory: %w", err)
+		}
+
+		// Size and age based rotation is handled by lumberjack
+		writer := &lumberjack.Logger{
+			Filename:   config.FilePath,
+			MaxSize:    config.MaxSizeMB,
+			MaxAge:     config.MaxAgeDays,
+			MaxBackups: config.MaxBackups,
+			Compress:   config.Compress,
+		}
+		log.SetOutput(writer)
+
+		// Time based rotation
+		done := make(chan struct{})
+		if config.RotateInterval > 0 {
+			ticker := time.NewTicker(config.RotateInterval)
+			go func() {
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						if err := writer.Rotate(); err != nil {
+							log.Printf("Failed to rotate log file: %v", err)
+						}
+					case <-done:
+						return
+					}
+				}
+			}()
+		}
+
+		// Return shutdown function
+		return func() error {
+			close(done)
+			return writer.Close()
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported log output: %s", config.Output)
+	}
+}
+
+// LoadLoggingConfigFromEnv loads logging configuration from environment variables
+func LoadLoggingConfigFromEnv(environment string) LoggingConfig {
+	config := LoggingConfig{
+		Output:        os.Getenv("LOG_OUTPUT"),
+		FilePath:      os.Getenv("LOG_FILE_PATH"),
+		MaxSizeMB:     100,
+		MaxAgeDays:    28,
+		MaxBackups:    3,
+		SlowThreshold: time.Second,
+	}
+
+	// Default to stdout in development, file in production
+	if config.Output == "" {
+		if environment == "production" {
+			config.Output = "file"
+		} else {
+			config.Output = "stdout"
+		}
+	}
+
+	if config.FilePath == "" {
+		config.FilePath = "logs/user-api.log"
+	}
+
+	// Parse rotation settings
+	if size, err := strconv.Atoi(os.Getenv("LOG_MAX_SIZE_MB")); err == nil && size > 0 {
+		config.MaxSizeMB = size
+	}
+	if age, err := strconv.Atoi(os.Getenv("LOG_MAX_AGE_DAYS")); err == nil && age >= 0 {
+		config.MaxAgeDays = age
+	}
+	if backups, err := strconv.Atoi(os.Getenv("LOG_MAX_BACKUPS")); err == nil && backups >= 0 {
+		config.MaxBackups = backups
+	}
+	if compress := os.Getenv("LOG_COMPRESS"); compress != "" {
+		config.Compress, _ = strconv.ParseBool(compress)
+	}
+	if includeSampled := os.Getenv("LOG_INCLUDE_SAMPLED"); includeSampled != "" {
+		config.IncludeSampled, _ = strconv.ParseBool(includeSampled)
+	}
+	if value := os.Getenv("LOG_SAMPLE_RATE"); value != "" {
+		if rate, err := strconv.ParseFloat(value, 64); err == nil && rate >= 0 && rate <= 1 {
+			config.SampleRate = &rate
+		} else {
+			log.Printf("Invalid LOG_SAMPLE_RATE %q, logging all requests", value)
+		}
+	}
+	if threshold := os.Getenv("LOG_SLOW_THRESHOLD"); threshold != "" {
+		if d, err := time.ParseDuration(threshold); err == nil {
+			config.SlowThreshold = d
+		}
+	}
+	if interval := os.Getenv("LOG_ROTATE_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			config.RotateInterval = d
+		}
+	}
+
+	return config
+}
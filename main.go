@@ -3,23 +3,50 @@ package main
 import (
 	"context"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"strings"
 	"syscall"
 	"time"
 	"user-api/config"
 	"user-api/handlers"
+	"user-api/health"
+	"user-api/logging"
 	"user-api/middleware"
+	"user-api/models"
 	"user-api/repository"
 	"user-api/services"
 	"user-api/tracing"
+	"user-api/utils"
+	"user-api/version"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/net/netutil"
 )
 
 func main() {
 	// Load configuration
-	cfg := config.LoadConfig()
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Track readiness until setup completes
+	readiness := health.NewReadiness()
+
+	// Initialize logging
+	loggingShutdown, err := logging.InitLogging(cfg.Logging)
+	if err != nil {
+		log.Fatalf("Failed to initialize logging: %v", err)
+	}
+	defer func() {
+		if err := loggingShutdown(); err != nil {
+			log.Printf("Failed to shutdown logging: %v", err)
+		}
+	}()
 
 	// Initialize tracing
 	tracingShutdown, err := tracing.InitTracing(cfg.Tracing)
@@ -39,51 +66,173 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	// Configure response helpers
+	utils.SetErrorFormat(cfg.ErrorFormat)
+	utils.SetBatchStatusMode(cfg.BatchStatusMode)
+	utils.SetMaxResponseBytes(cfg.MaxResponseBytes)
+	utils.SetMaxJSONDepth(cfg.MaxJSONDepth)
+	models.SetNullOptionals(cfg.NullOptionals)
+	models.SetIDChecksum(cfg.IDChecksum)
+	models.SetAcceptCamelCase(cfg.AcceptCamelCase)
+	if err := models.SetNameFormat(cfg.NameFormat, cfg.NameSeparator); err != nil {
+		log.Fatalf("Invalid NAME_FORMAT: %v", err)
+	}
+
 	// Initialize repository
-	userRepo := repository.NewInMemoryUserRepository()
+	memoryRepo := repository.NewInMemoryUserRepository()
+	memoryRepo.SetTombstoneRetention(cfg.TombstoneRetention)
+	var userRepo repository.UserRepository = memoryRepo
+	if cfg.BoltPath != "" {
+		boltRepo, err := repository.NewBoltUserRepository(cfg.BoltPath)
+		if err != nil {
+			log.Fatalf("Failed to open BoltDB repository: %v", err)
+		}
+		defer boltRepo.Close()
+		boltRepo.SetTombstoneRetention(cfg.TombstoneRetention)
+		userRepo = boltRepo
+		log.Printf("Persisting users to %s", cfg.BoltPath)
+	}
 
 	// Initialize service
-	userService := services.NewUserService(userRepo)
+	userService, err := services.NewUserServiceWithConfig(userRepo, cfg.Users)
+	if err != nil {
+		log.Fatalf("Failed to initialize user service: %v", err)
+	}
+
+	// Preload the list cache in the background so the first list requests are fast
+	// without delaying readiness
+	tracing.GoWithContext(context.Background(), "startup.warm_list_cache", func(ctx context.Context) {
+		if warmed, err := userService.WarmListCache(ctx, utils.DefaultLimit); err != nil {
+			log.Printf("List cache warming stopped after %d pages: %v", warmed, err)
+		} else if warmed > 0 {
+			log.Printf("List cache warmed with %d pages", warmed)
+		}
+	})
 
 	// Initialize handler
 	userHandler := handlers.NewUserHandler(userService)
+	checks := health.NewRegistry()
+	checks.Register(health.NewCheckFunc("repository", userRepo.Ping))
+	checks.Register(health.NewCheckFunc("tracing", func(ctx context.Context) error {
+		return tracing.CheckConnectivity(ctx, cfg.Tracing)
+	}))
+	healthHandler := handlers.NewHealthHandler(readiness, checks)
+
+	// Resolve the expected user ID format
+	idPattern := middleware.UUIDPattern
+	if cfg.IDPattern != "" {
+		idPattern, err = regexp.Compile(cfg.IDPattern)
+		if err != nil {
+			log.Fatalf("Invalid ID_PATTERN: %v", err)
+		}
+	}
+
+	// Parse IP filter ranges, failing fast on bad entries
+	allowedIPs, err := middleware.ParseCIDRs(cfg.IPAllowList)
+	if err != nil {
+		log.Fatalf("Invalid IP_ALLOW_LIST: %v", err)
+	}
+	deniedIPs, err := middleware.ParseCIDRs(cfg.IPDenyList)
+	if err != nil {
+		log.Fatalf("Invalid IP_DENY_LIST: %v", err)
+	}
 
 	// Initialize Gin router
 	router := gin.New()
 
+	// Only trust forwarding headers from configured proxies so client IPs can't be spoofed
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// Add middleware
-	router.Use(middleware.Recovery())
-	router.Use(middleware.Logger())
+	router.Use(middleware.Recovery(cfg.PanicDetails))
+	router.Use(middleware.Logger(cfg.Logging))
 	router.Use(middleware.CORS())
 
 	// Add tracing middleware if enabled
 	if cfg.Tracing.Enabled {
-		router.Use(middleware.TracingMiddleware(tracing.ServiceName))
+		router.Use(middleware.TracingMiddleware(tracing.ServiceName, cfg.Tracing.IgnoredPaths...))
 		router.Use(middleware.EnhancedTracingMiddleware())
+		if cfg.Tracing.ResponseHeaders {
+			router.Use(middleware.TraceResponseHeaders())
+		}
+		router.Use(middleware.ClientAttribution(cfg.KnownClients...))
+	}
+	if len(allowedIPs) > 0 || len(deniedIPs) > 0 {
+		router.Use(middleware.IPFilter(allowedIPs, deniedIPs))
 	}
+	router.Use(middleware.Inflight(cfg.InflightHeader))
+	if cfg.SafeMethodGuard {
+		router.Use(middleware.SafeMethodGuard(func(ctx context.Context) (int, error) {
+			stats, err := userRepo.Stats(ctx)
+			return stats.UserCount, err
+		}))
+	}
+	router.Use(middleware.DBOperationCounter())
 
 	// Health check endpoint
 	router.GET("/health", userHandler.HealthCheck)
+	router.GET("/readyz", healthHandler.Readiness)
+	router.GET("/version", handlers.Version)
+	if cfg.DebugStatsEndpoint {
+		router.GET("/debug/stats", userHandler.DebugStats)
+	}
+	if cfg.IntegrityEndpoint {
+		router.GET("/admin/integrity", userHandler.VerifyIntegrity)
+		router.POST("/admin/integrity/repair", userHandler.VerifyIntegrity)
+	}
 
 	// API routes
 	api := router.Group("/api")
+	api.Use(middleware.QueryParamLimit(cfg.MaxQueryParams, "page", "limit", "tz", "format", "verbose", "changed_since", "name_format", "if_not_exists"))
+	if cfg.ContentLengthCheck {
+		api.Use(middleware.ContentLengthCheck(int64(cfg.MaxBodyBytes)))
+	}
+	api.Use(middleware.GzipDecompression(int64(cfg.MaxGzipBodyBytes)))
+	api.Use(middleware.APIVersioning(cfg.APIDefaultVersion, cfg.APIVersions...))
+	if len(cfg.RequiredHeaders) > 0 {
+		api.Use(middleware.RequiredHeaders(cfg.RequiredHeaders...))
+	}
 	{
 		// User routes
 		users := api.Group("/users")
-		users.Use(middleware.JSONContentType()) // Apply JSON content type middleware to user routes
+		users.Use(middleware.JSONContentType(cfg.AllowJSONSubtypes)) // Apply JSON content type middleware to user routes
+		validateID := middleware.ValidateIDParam("id", idPattern)
+		listParams := middleware.ListParams()
 		{
-			users.POST("", userHandler.CreateUser)   // POST /api/users
-			users.GET("", userHandler.GetUsers)      // GET /api/users
-			users.GET("/:id", userHandler.GetUser)   // GET /api/users/:id
+			users.POST("", userHandler.CreateUser)                // POST /api/users
+			users.GET("", listParams, userHandler.GetUsers)       // GET /api/users
+			users.PUT("/bulk", userHandler.BulkUpsertUsers)       // PUT /api/users/bulk
+			users.POST("/validate", userHandler.ValidateUsers)    // POST /api/users/validate
+			users.GET("/schema", userHandler.GetUserSchema)       // GET /api/users/schema
+			users.GET("/events", userHandler.StreamUserEvents)    // GET /api/users/events
+			users.GET("/:id", validateID, userHandler.GetUser)    // GET /api/users/:id
+			users.PUT("/:id", validateID, userHandler.UpdateUser) // PUT /api/users/:id
+
+			// Duplicate detection compares every pair of users and returns them in bulk
+			if cfg.DuplicatesEndpoint {
+				users.GET("/duplicates", userHandler.FindDuplicates) // GET /api/users/duplicates
+			}
+			if cfg.WebSocketEnabled {
+				users.GET("/ws", userHandler.UserEventsWebSocket) // GET /api/users/ws
+			}
+		}
+
+		// Deployment smoke test, never registered in production
+		if cfg.SelfTestEndpoint {
+			api.GET("/selftest", userHandler.SelfTest) // GET /api/selftest
 		}
 	}
 
 	// Start server
 	log.Printf("Starting server on port %s", cfg.Port)
+	log.Printf("Version: %s (commit %s, built %s)", version.Version, version.Commit, version.BuildTime)
 	log.Printf("Environment: %s", cfg.Environment)
+	log.Printf("Log output: %s", cfg.Logging.Output)
 	log.Printf("Tracing enabled: %v", cfg.Tracing.Enabled)
 	if cfg.Tracing.Enabled {
-		log.Printf("Tracing exporter: %s", cfg.Tracing.ExporterType)
+		log.Printf("Tracing exporters: %s", strings.Join(cfg.Tracing.ExporterTypes, ", "))
 		log.Printf("Tracing sampling rate: %.2f", cfg.Tracing.SamplingRate)
 	}
 	log.Printf("Health check: http://localhost:%s/health", cfg.Port)
@@ -93,13 +242,61 @@ func main() {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
+	server := &http.Server{
+		Addr:         ":" + cfg.Port,
+		Handler:      router,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+	listener, err := newListener(server.Addr, cfg.MaxConnections)
+	if err != nil {
+		log.Fatal("Failed to start server:", err)
+	}
+	if cfg.MaxConnections > 0 {
+		log.Printf("Max connections: %d", cfg.MaxConnections)
+	}
+
 	go func() {
-		if err := router.Run(":" + cfg.Port); err != nil {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			log.Fatal("Failed to start server:", err)
 		}
 	}()
 
+	// Setup complete, start accepting traffic
+	if err := readiness.SetReady(); err != nil {
+		log.Fatalf("Failed to mark server ready: %v", err)
+	}
+
 	// Wait for interrupt signal
 	<-c
+	readiness.SetShuttingDown()
+	userHandler.Shutdown()
 	log.Println("Shutting down server...")
+
+	// Stop accepting connections and let in-flight requests finish before tracing is flushed
+	if err := shutdownServer(server, 5*time.Second); err != nil {
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+	log.Println("Server stopped")
+}
+
+// shutdownServer gracefully stops the server, waiting up to timeout for active requests to complete
+func shutdownServer(server *http.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
+
+// newListener listens on addr, capping simultaneous connections at maxConnections when positive.
+// Connections beyond the cap wait in the accept queue until one closes.
+func newListener(addr string, maxConnections int) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if maxConnections > 0 {
+		listener = netutil.LimitListener(listener, maxConnections)
+	}
+	return listener, nil
 }
@@ -1,20 +1,49 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"user-api/config"
 	"user-api/handlers"
+	"user-api/health"
+	"user-api/logging"
+	"user-api/middleware"
 	"user-api/models"
 	"user-api/repository"
 	"user-api/services"
 	"user-api/tracing"
+	"user-api/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func setupTestRouter() *gin.Engine {
@@ -28,18 +57,67 @@ func setupTestRouter() *gin.Engine {
 	// Setup router
 	router := gin.New()
 	router.GET("/health", userHandler.HealthCheck)
+	router.GET("/debug/stats", userHandler.DebugStats)
 
 	api := router.Group("/api")
 	users := api.Group("/users")
 	{
 		users.POST("", userHandler.CreateUser)
-		users.GET("", userHandler.GetUsers)
+		users.GET("", middleware.ListParams(), userHandler.GetUsers)
+		users.PUT("/bulk", userHandler.BulkUpsertUsers)
+		users.POST("/validate", userHandler.ValidateUsers)
+		users.GET("/schema", userHandler.GetUserSchema)
+		users.GET("/duplicates", userHandler.FindDuplicates)
+		users.GET("/events", userHandler.StreamUserEvents)
+		users.GET("/ws", userHandler.UserEventsWebSocket)
 		users.GET("/:id", userHandler.GetUser)
+		users.PUT("/:id", userHandler.UpdateUser)
 	}
 
 	return router
 }
 
+// setupSpanRecorder installs a tracer provider that records ended spans in memory
+func setupSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		tp.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+// findSpan returns the first ended span with the given name
+func findSpan(recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	return nil
+}
+
+// loadConfig loads the configuration from the environment, failing the test on error
+func loadConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	return cfg
+}
+
+// loadUserServiceConfig loads the user service configuration, failing the test on error
+func loadUserServiceConfig(t *testing.T) services.UserServiceConfig {
+	t.Helper()
+	cfg, err := services.LoadUserServiceConfigFromEnv()
+	if err != nil {
+		t.Fatalf("LoadUserServiceConfigFromEnv: %v", err)
+	}
+	return cfg
+}
+
 func TestHealthCheck(t *testing.T) {
 	router := setupTestRouter()
 
@@ -172,10 +250,10 @@ func TestGetUsers(t *testing.T) {
 func TestTracingIntegration(t *testing.T) {
 	// Initialize tracing for test
 	tracingConfig := tracing.TracingConfig{
-		Enabled:      true,
-		ExporterType: "console",
-		SamplingRate: 1.0,
-		Environment:  "test",
+		Enabled:       true,
+		ExporterTypes: []string{"console"},
+		SamplingRate:  1.0,
+		Environment:   "test",
 	}
 
 	shutdown, err := tracing.InitTracing(tracingConfig)
@@ -199,3 +277,3863 @@ func TestTracingIntegration(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "success", response["status"])
 }
+
+// TestFileLogging tests that logs are written to the configured file
+func TestFileLogging(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "app.log")
+
+	shutdown, err := logging.InitLogging(logging.LoggingConfig{
+		Output:    "file",
+		FilePath:  logPath,
+		MaxSizeMB: 1,
+	})
+	assert.NoError(t, err)
+	defer log.SetOutput(os.Stderr)
+
+	log.Println("file logging test line")
+	assert.NoError(t, shutdown())
+
+	content, err := os.ReadFile(logPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "file logging test line")
+}
+
+func TestProblemJSONErrorFormat(t *testing.T) {
+	utils.SetErrorFormat(utils.ErrorFormatProblem)
+	defer utils.SetErrorFormat(utils.ErrorFormatEnvelope)
+
+	router := setupTestRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/users/does-not-exist", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "about:blank", response["type"])
+	assert.Equal(t, "Not Found", response["title"])
+	assert.Equal(t, float64(404), response["status"])
+	assert.Equal(t, "User not found", response["detail"])
+	assert.Equal(t, "/api/users/does-not-exist", response["instance"])
+}
+
+// assertProblemResponse checks that w holds an RFC 7807 problem with the given status and detail
+func assertProblemResponse(t *testing.T, w *httptest.ResponseRecorder, wantStatus int, wantDetail string) {
+	t.Helper()
+	assert.Equal(t, wantStatus, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, float64(wantStatus), response["status"])
+	assert.Equal(t, wantDetail, response["detail"])
+}
+
+func TestParsePagination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantPage  int
+		wantLimit int
+		wantErr   bool
+	}{
+		{name: "defaults", query: "", wantPage: utils.DefaultPage, wantLimit: utils.DefaultLimit},
+		{name: "explicit values", query: "?page=3&limit=50", wantPage: 3, wantLimit: 50},
+		{name: "max limit", query: "?limit=100", wantPage: 1, wantLimit: 100},
+		{name: "non-numeric page", query: "?page=abc", wantErr: true},
+		{name: "zero page", query: "?page=0", wantErr: true},
+		{name: "negative limit", query: "?limit=-1", wantErr: true},
+		{name: "limit above max", query: "?limit=101", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request, _ = http.NewRequest("GET", "/api/users"+tt.query, nil)
+
+			page, limit, err := utils.ParsePagination(c)
+			if tt.wantErr {
+				var paginationErr *utils.PaginationError
+				assert.ErrorAs(t, err, &paginationErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantPage, page)
+			assert.Equal(t, tt.wantLimit, limit)
+		})
+	}
+}
+
+func TestGetUsersPagination(t *testing.T) {
+	router := setupTestRouter()
+
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		jsonData, _ := json.Marshal(models.CreateUserRequest{FirstName: "Page", LastName: "User", Email: email})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 201, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/users?page=2&limit=2", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+
+	data := response["data"].([]interface{})
+	assert.Len(t, data, 1)
+
+	pagination := response["pagination"].(map[string]interface{})
+	assert.Equal(t, float64(2), pagination["page"])
+	assert.Equal(t, float64(2), pagination["limit"])
+	assert.Equal(t, float64(3), pagination["total"])
+	assert.Equal(t, float64(2), pagination["total_pages"])
+
+	// Invalid pagination returns 400
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users?limit=1000", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestBulkUpsertUsers(t *testing.T) {
+	router := setupTestRouter()
+
+	// Create an existing user
+	existing := models.CreateUserRequest{FirstName: "Existing", LastName: "User", Email: "existing@example.com"}
+	jsonData, _ := json.Marshal(existing)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 201, w.Code)
+
+	var created map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	existingID := created["data"].(map[string]interface{})["id"]
+
+	// Upsert a mix of new, existing, and invalid users
+	batch := []models.CreateUserRequest{
+		{FirstName: "Fresh", LastName: "User", Email: "fresh@example.com"},
+		{FirstName: "Renamed", LastName: "User", Email: "existing@example.com"},
+		{FirstName: "", LastName: "User", Email: "broken@example.com"},
+	}
+	jsonData, _ = json.Marshal(batch)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/api/users/bulk", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 207, w.Code)
+	assert.Equal(t, "true", w.Header().Get("X-Partial-Success"))
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+
+	results := response["data"].([]interface{})
+	assert.Len(t, results, 3)
+
+	first := results[0].(map[string]interface{})
+	assert.Equal(t, "created", first["status"])
+
+	second := results[1].(map[string]interface{})
+	assert.Equal(t, "updated", second["status"])
+	updatedUser := second["user"].(map[string]interface{})
+	assert.Equal(t, existingID, updatedUser["id"])
+	assert.Equal(t, "Renamed", updatedUser["first_name"])
+
+	third := results[2].(map[string]interface{})
+	assert.Equal(t, "error", third["status"])
+	assert.NotEmpty(t, third["error"])
+
+	// The existing user was updated in place
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users/"+existingID.(string), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	var fetched map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &fetched)
+	assert.Equal(t, "Renamed", fetched["data"].(map[string]interface{})["first_name"])
+}
+
+func TestLoggerOmitsTraceIDForUnsampledRequests(t *testing.T) {
+	shutdown, err := tracing.InitTracing(tracing.TracingConfig{
+		Enabled:       true,
+		ExporterTypes: []string{"console"},
+		SamplingRate:  0.0,
+		Environment:   "test",
+	})
+	assert.NoError(t, err)
+	defer shutdown(context.Background())
+
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.TracingMiddleware(tracing.ServiceName))
+	router.Use(middleware.Logger(logging.LoggingConfig{IncludeSampled: true}))
+	router.GET("/ping", func(c *gin.Context) { c.Status(200) })
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ping", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, logBuf.String(), "GET /ping 200")
+	assert.Contains(t, logBuf.String(), "sampled=false")
+	assert.NotContains(t, logBuf.String(), "trace_id=")
+	assert.NotContains(t, logBuf.String(), "span_id=")
+}
+
+func TestLoggerSampling(t *testing.T) {
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+
+	gin.SetMode(gin.TestMode)
+	dropSuccesses := 0.0
+	router := gin.New()
+	router.Use(middleware.Logger(logging.LoggingConfig{SampleRate: &dropSuccesses, SlowThreshold: time.Hour}))
+	router.GET("/ok", func(c *gin.Context) { c.Status(200) })
+	router.GET("/missing", func(c *gin.Context) { c.Status(404) })
+	router.GET("/broken", func(c *gin.Context) { c.Status(500) })
+
+	for i := 0; i < 10; i++ {
+		for _, path := range []string{"/ok", "/missing", "/broken"} {
+			req, _ := http.NewRequest("GET", path, nil)
+			router.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	}
+
+	// Errors are always logged while successes are sampled out
+	assert.Equal(t, 0, strings.Count(logBuf.String(), "GET /ok 200"))
+	assert.Equal(t, 10, strings.Count(logBuf.String(), "GET /missing 404"))
+	assert.Equal(t, 10, strings.Count(logBuf.String(), "GET /broken 500"))
+
+	// Slow successful requests are always logged
+	logBuf.Reset()
+	router = gin.New()
+	router.Use(middleware.Logger(logging.LoggingConfig{SampleRate: &dropSuccesses, SlowThreshold: time.Nanosecond}))
+	router.GET("/slow", func(c *gin.Context) {
+		time.Sleep(time.Millisecond)
+		c.Status(200)
+	})
+	req, _ := http.NewRequest("GET", "/slow", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Contains(t, logBuf.String(), "GET /slow 200")
+
+	// LOG_SAMPLE_RATE=0 drops successes, while unset logs everything
+	t.Setenv("LOG_SAMPLE_RATE", "0")
+	rate := logging.LoadLoggingConfigFromEnv("development").SampleRate
+	if assert.NotNil(t, rate) {
+		assert.Zero(t, *rate)
+	}
+	t.Setenv("LOG_SAMPLE_RATE", "")
+	assert.Nil(t, logging.LoadLoggingConfigFromEnv("development").SampleRate)
+	t.Setenv("LOG_SAMPLE_RATE", "2")
+	assert.Nil(t, logging.LoadLoggingConfigFromEnv("development").SampleRate)
+}
+
+func TestGetUserTimezone(t *testing.T) {
+	router := setupTestRouter()
+
+	jsonData, _ := json.Marshal(models.CreateUserRequest{FirstName: "Somchai", LastName: "Jaidee", Email: "somchai@example.com"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 201, w.Code)
+
+	var created map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	id := created["data"].(map[string]interface{})["id"].(string)
+
+	// Converted to the requested zone
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users/"+id+"?tz=Asia/Bangkok", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	createdAt, err := time.Parse(time.RFC3339Nano, response["data"].(map[string]interface{})["created_at"].(string))
+	assert.NoError(t, err)
+	_, offset := createdAt.Zone()
+	assert.Equal(t, 7*60*60, offset)
+
+	// Defaults to UTC
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users/"+id, nil)
+	router.ServeHTTP(w, req)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	createdAt, err = time.Parse(time.RFC3339Nano, response["data"].(map[string]interface{})["created_at"].(string))
+	assert.NoError(t, err)
+	_, offset = createdAt.Zone()
+	assert.Equal(t, 0, offset)
+
+	// Unknown zone is rejected
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users/"+id+"?tz=Mars/Olympus", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestQueryParamLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api := router.Group("/api")
+	api.Use(middleware.QueryParamLimit(3, "page", "limit"))
+	api.GET("/users", func(c *gin.Context) { c.Status(200) })
+
+	// A non-positive limit disables the count but still rejects repeated keys
+	unlimited := router.Group("/unlimited")
+	unlimited.Use(middleware.QueryParamLimit(0, "page"))
+	unlimited.GET("/users", func(c *gin.Context) { c.Status(200) })
+
+	tests := []struct {
+		name     string
+		path     string
+		query    string
+		wantCode int
+	}{
+		{name: "within limit", path: "/api/users", query: "?page=1&limit=10", wantCode: 200},
+		{name: "duplicate page", path: "/api/users", query: "?page=1&page=2", wantCode: 400},
+		{name: "too many parameters", path: "/api/users", query: "?a=1&b=2&c=3&d=4", wantCode: 400},
+		{name: "disabled limit", path: "/unlimited/users", query: "?a=1&b=2&c=3&d=4", wantCode: 200},
+		{name: "disabled limit without parameters", path: "/unlimited/users", wantCode: 200},
+		{name: "disabled limit duplicate page", path: "/unlimited/users", query: "?page=1&page=2", wantCode: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path+tt.query, nil)
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+
+	// Rejections honor ERROR_FORMAT
+	utils.SetErrorFormat(utils.ErrorFormatProblem)
+	defer utils.SetErrorFormat(utils.ErrorFormatEnvelope)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/users?page=1&page=2", nil)
+	router.ServeHTTP(w, req)
+	assertProblemResponse(t, w, 400, `Query parameter "page" must not be repeated`)
+}
+
+func TestReadinessStateTransitions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	readiness := health.NewReadiness()
+	healthHandler := handlers.NewHealthHandler(readiness, nil)
+	router := gin.New()
+	router.GET("/readyz", healthHandler.Readiness)
+
+	checkReadyz := func(wantCode int, wantState health.State) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/readyz", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, wantCode, w.Code)
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, string(wantState), response["state"])
+	}
+
+	// Starting
+	assert.Equal(t, health.StateStarting, readiness.State())
+	checkReadyz(503, health.StateStarting)
+
+	// Ready
+	assert.NoError(t, readiness.SetReady())
+	checkReadyz(200, health.StateReady)
+
+	// Shutting down
+	readiness.SetShuttingDown()
+	checkReadyz(503, health.StateShuttingDown)
+
+	// Cannot become ready again once shutting down
+	assert.Error(t, readiness.SetReady())
+	assert.Equal(t, health.StateShuttingDown, readiness.State())
+}
+
+func TestMaxResponseSizeGuard(t *testing.T) {
+	router := setupTestRouter()
+
+	for i := 0; i < 20; i++ {
+		jsonData, _ := json.Marshal(models.CreateUserRequest{
+			FirstName: "Large",
+			LastName:  "Dataset",
+			Email:     fmt.Sprintf("large%d@example.com", i),
+		})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 201, w.Code)
+	}
+
+	utils.SetMaxResponseBytes(2048)
+	defer utils.SetMaxResponseBytes(0)
+
+	// The full list exceeds the limit
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/users?limit=100", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 500, w.Code)
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "Response too large", response["message"])
+	assert.Contains(t, response["error"], "page and limit")
+
+	// A small page fits
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users?limit=2", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestHandlerSpanNameDerivedFromHandler(t *testing.T) {
+	recorder := setupSpanRecorder(t)
+	router := setupTestRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/users", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	assert.NotNil(t, findSpan(recorder, "GetUsers"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/health", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	assert.NotNil(t, findSpan(recorder, "HealthCheck"))
+}
+
+func TestEmailDomainAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		domains []string
+		email   string
+		wantErr bool
+	}{
+		{name: "allowed domain", domains: []string{"corp.example.com"}, email: "alice@corp.example.com"},
+		{name: "allowed domain is case insensitive", domains: []string{"corp.example.com"}, email: "alice@CORP.example.com"},
+		{name: "disallowed domain", domains: []string{"corp.example.com"}, email: "alice@gmail.com", wantErr: true},
+		{name: "empty allowlist allows all", domains: nil, email: "alice@gmail.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userService, err := services.NewUserServiceWithConfig(repository.NewInMemoryUserRepository(), services.UserServiceConfig{
+				AllowedEmailDomains: tt.domains,
+			})
+			assert.NoError(t, err)
+
+			_, err = userService.CreateUser(context.Background(), models.CreateUserRequest{
+				FirstName: "Alice",
+				LastName:  "Smith",
+				Email:     tt.email,
+			})
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "must use an allowed domain")
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestEmailDomainAllowlistRejectedWithBadRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	userService, err := services.NewUserServiceWithConfig(repository.NewInMemoryUserRepository(), services.UserServiceConfig{
+		AllowedEmailDomains: []string{"corp.example.com"},
+	})
+	assert.NoError(t, err)
+	userHandler := handlers.NewUserHandler(userService)
+	router := gin.New()
+	router.POST("/api/users", userHandler.CreateUser)
+
+	jsonData, _ := json.Marshal(models.CreateUserRequest{FirstName: "Alice", LastName: "Smith", Email: "alice@gmail.com"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/version", handlers.Version)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/version", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	for _, field := range []string{"version", "commit", "build_time", "go_version"} {
+		assert.NotEmpty(t, response[field], field)
+	}
+}
+
+func TestGzipRequestBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	userService := services.NewUserService(repository.NewInMemoryUserRepository())
+	userHandler := handlers.NewUserHandler(userService)
+	router := gin.New()
+	router.Use(middleware.GzipDecompression(1024))
+	router.POST("/api/users", userHandler.CreateUser)
+
+	gzipBody := func(data []byte) *bytes.Buffer {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(data)
+		gz.Close()
+		return &buf
+	}
+
+	// Compressed request is decompressed before binding
+	jsonData, _ := json.Marshal(models.CreateUserRequest{FirstName: "Gzip", LastName: "User", Email: "gzip@example.com"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/users", gzipBody(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 201, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "gzip@example.com", response["data"].(map[string]interface{})["email"])
+
+	// Malformed gzip is rejected
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/users", bytes.NewBufferString("not gzip"))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+
+	// Decompressed output above the limit is rejected, honoring ERROR_FORMAT
+	utils.SetErrorFormat(utils.ErrorFormatProblem)
+	defer utils.SetErrorFormat(utils.ErrorFormatEnvelope)
+
+	padded, _ := json.Marshal(models.CreateUserRequest{
+		FirstName: "Bomb",
+		LastName:  "User",
+		Email:     "bomb@example.com",
+		Phone:     strings.Repeat("1", 4096),
+	})
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/users", gzipBody(padded))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	router.ServeHTTP(w, req)
+	assertProblemResponse(t, w, 413, "Decompressed request body exceeds the 1024 byte limit")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/users", bytes.NewBufferString("not gzip"))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	router.ServeHTTP(w, req)
+	assertProblemResponse(t, w, 400, "Malformed gzip request body")
+}
+
+func TestContentLengthCheck(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	userService := services.NewUserService(repository.NewInMemoryUserRepository())
+	userHandler := handlers.NewUserHandler(userService)
+	router := gin.New()
+	router.Use(middleware.ContentLengthCheck(1024))
+	router.POST("/api/users", userHandler.CreateUser)
+
+	jsonData, _ := json.Marshal(models.CreateUserRequest{FirstName: "Length", LastName: "User", Email: "length@example.com"})
+
+	// Matching length is bound as usual
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 201, w.Code)
+
+	// Declared length longer than the body is rejected as truncated
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = int64(len(jsonData) + 10)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "does not match Content-Length")
+
+	// Declared length shorter than the body is rejected too
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = int64(len(jsonData) - 5)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+
+	// Declared lengths above the cap are refused without reading the body
+	body := &countingReader{Reader: bytes.NewReader(jsonData)}
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/users", body)
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = 1 << 40
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Zero(t, body.read)
+
+	// Rejections honor ERROR_FORMAT
+	utils.SetErrorFormat(utils.ErrorFormatProblem)
+	defer utils.SetErrorFormat(utils.ErrorFormatEnvelope)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = 2048
+	router.ServeHTTP(w, req)
+	assertProblemResponse(t, w, 413, "Content-Length 2048 exceeds the 1024 byte limit")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = int64(len(jsonData) + 10)
+	router.ServeHTTP(w, req)
+	assertProblemResponse(t, w, 400, fmt.Sprintf("Request body length %d does not match Content-Length %d", len(jsonData), len(jsonData)+10))
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	io.Reader
+	read int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += n
+	return n, err
+}
+
+func TestCustomValidationRules(t *testing.T) {
+	rules, err := services.ParseValidationRules(`[{"field":"first_name","pattern":"^[A-Za-z]+$","message":"first_name may only contain letters"}]`)
+	assert.NoError(t, err)
+
+	userService, err := services.NewUserServiceWithConfig(repository.NewInMemoryUserRepository(), services.UserServiceConfig{
+		ValidationRules: rules,
+	})
+	assert.NoError(t, err)
+
+	// Accepted by the rule
+	_, err = userService.CreateUser(context.Background(), models.CreateUserRequest{FirstName: "Alice", LastName: "Smith", Email: "alice@example.com"})
+	assert.NoError(t, err)
+
+	// Rejected by the rule
+	_, err = userService.CreateUser(context.Background(), models.CreateUserRequest{FirstName: "Al1ce", LastName: "Smith", Email: "al1ce@example.com"})
+	var validationErr *services.ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "first_name may only contain letters", err.Error())
+
+	// Bad patterns and unknown fields fail fast
+	_, err = services.NewUserServiceWithConfig(repository.NewInMemoryUserRepository(), services.UserServiceConfig{
+		ValidationRules: []services.ValidationRule{{Field: "first_name", Pattern: "([a-z"}},
+	})
+	assert.Error(t, err)
+
+	_, err = services.NewUserServiceWithConfig(repository.NewInMemoryUserRepository(), services.UserServiceConfig{
+		ValidationRules: []services.ValidationRule{{Field: "nickname", Pattern: "^[a-z]+$"}},
+	})
+	assert.Error(t, err)
+}
+
+func TestGoWithContextLinksAsyncSpan(t *testing.T) {
+	recorder := setupSpanRecorder(t)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+
+	done := make(chan struct{})
+	tracing.GoWithContext(ctx, "async.work", func(ctx context.Context) {
+		defer close(done)
+		assert.True(t, trace.SpanContextFromContext(ctx).IsValid())
+	})
+	parent.End()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("async work did not run")
+	}
+
+	// The span ends after fn returns
+	assert.Eventually(t, func() bool { return findSpan(recorder, "async.work") != nil }, time.Second, 10*time.Millisecond)
+
+	asyncSpan := findSpan(recorder, "async.work")
+	assert.Len(t, asyncSpan.Links(), 1)
+	assert.Equal(t, parent.SpanContext().TraceID(), asyncSpan.Links()[0].SpanContext.TraceID())
+	assert.Equal(t, parent.SpanContext().SpanID(), asyncSpan.Links()[0].SpanContext.SpanID())
+}
+
+func TestListUsersCache(t *testing.T) {
+	recorder := setupSpanRecorder(t)
+
+	userRepo := repository.NewInMemoryUserRepository()
+	userService, err := services.NewUserServiceWithConfig(userRepo, services.UserServiceConfig{
+		ListCacheTTL: time.Minute,
+	})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = userService.CreateUser(ctx, models.CreateUserRequest{FirstName: "Cache", LastName: "One", Email: "cache1@example.com"})
+	assert.NoError(t, err)
+
+	_, total, err := userService.ListUsers(ctx, 1, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+
+	// A write that bypasses the service is not visible: the second read is served from cache
+	userRepo.Create(ctx, models.NewUser(models.CreateUserRequest{FirstName: "Hidden", LastName: "User", Email: "hidden@example.com"}))
+	_, total, err = userService.ListUsers(ctx, 1, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+
+	var hits []bool
+	for _, span := range recorder.Ended() {
+		if span.Name() != "UserService.ListUsers" {
+			continue
+		}
+		for _, attr := range span.Attributes() {
+			if attr.Key == "cache.hit" {
+				hits = append(hits, attr.Value.AsBool())
+			}
+		}
+	}
+	assert.Equal(t, []bool{false, true}, hits)
+
+	// A create through the service invalidates the cache
+	_, err = userService.CreateUser(ctx, models.CreateUserRequest{FirstName: "Cache", LastName: "Two", Email: "cache2@example.com"})
+	assert.NoError(t, err)
+	_, total, err = userService.ListUsers(ctx, 1, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+}
+
+func TestCreateUserLocale(t *testing.T) {
+	router := setupTestRouter()
+
+	// Valid locale is persisted and returned
+	jsonData, _ := json.Marshal(models.CreateUserRequest{FirstName: "Somsri", LastName: "Dee", Email: "somsri@example.com", Locale: "th-TH"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 201, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(t, "th-TH", data["locale"])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users/"+data["id"].(string), nil)
+	router.ServeHTTP(w, req)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "th-TH", response["data"].(map[string]interface{})["locale"])
+
+	// Invalid locale is rejected
+	jsonData, _ = json.Marshal(models.CreateUserRequest{FirstName: "Bad", LastName: "Locale", Email: "badlocale@example.com", Locale: "not a locale"})
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Contains(t, response["error"], "BCP 47")
+}
+
+func TestValidatePathParam(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/users/:id", middleware.ValidatePathParam("id", middleware.UUIDPattern), func(c *gin.Context) {
+		c.String(200, c.Param("id"))
+	})
+
+	id := "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantID   string
+	}{
+		{name: "clean ID", path: "/api/users/" + id, wantCode: 200, wantID: id},
+		{name: "whitespace padded ID", path: "/api/users/%20" + id + "%20", wantCode: 200, wantID: id},
+		{name: "malformed ID", path: "/api/users/not-a-uuid", wantCode: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantID != "" {
+				assert.Equal(t, tt.wantID, w.Body.String())
+			}
+		})
+	}
+
+	// Rejections are validation errors that honor ERROR_FORMAT
+	utils.SetErrorFormat(utils.ErrorFormatProblem)
+	defer utils.SetErrorFormat(utils.ErrorFormatEnvelope)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/users/not-a-uuid", nil)
+	router.ServeHTTP(w, req)
+	assertProblemResponse(t, w, 400, `Validation failed: invalid path parameter "id"`)
+}
+
+func TestGetUsersEmpty(t *testing.T) {
+	router := setupTestRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/users", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"data":[]`)
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{}, response["data"])
+
+	pagination := response["pagination"].(map[string]interface{})
+	assert.Equal(t, float64(0), pagination["total"])
+	assert.Equal(t, float64(0), pagination["total_pages"])
+}
+
+func TestTraceResponseHeaders(t *testing.T) {
+	setupSpanRecorder(t)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.TracingMiddleware(tracing.ServiceName))
+	router.Use(middleware.TraceResponseHeaders())
+	router.GET("/ping", func(c *gin.Context) { c.Status(200) })
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ping", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Regexp(t, `^00-[0-9a-f]{32}-[0-9a-f]{16}-0[01]$`, w.Header().Get("traceparent"))
+
+	// The flag is off unless set, and invalid values are logged rather than silently ignored
+	t.Setenv("TRACING_RESPONSE_HEADERS", "true")
+	assert.True(t, tracing.LoadTracingConfigFromEnv("development").ResponseHeaders)
+
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+	t.Setenv("TRACING_RESPONSE_HEADERS", "on")
+	assert.False(t, tracing.LoadTracingConfigFromEnv("development").ResponseHeaders)
+	assert.Contains(t, logBuf.String(), `Invalid value for TRACING_RESPONSE_HEADERS: "on", using default false`)
+}
+
+func TestTracingMultipleExporters(t *testing.T) {
+	var console bytes.Buffer
+	memory := tracetest.NewInMemoryExporter()
+
+	shutdown, err := tracing.InitTracing(tracing.TracingConfig{
+		Enabled:       true,
+		ExporterTypes: []string{"console"},
+		SamplingRate:  1.0,
+		Environment:   "test",
+		ConsoleWriter: &console,
+	}, memory)
+	assert.NoError(t, err)
+
+	_, span := tracing.GetTracer("test").Start(context.Background(), "multi.exporter.span")
+	span.End()
+
+	// Flush before shutdown, which resets the in-memory exporter
+	tp := otel.GetTracerProvider().(*sdktrace.TracerProvider)
+	assert.NoError(t, tp.ForceFlush(context.Background()))
+	spans := memory.GetSpans()
+	assert.NoError(t, shutdown(context.Background()))
+
+	assert.Contains(t, console.String(), "multi.exporter.span")
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "multi.exporter.span", spans[0].Name)
+}
+
+func TestValidateExporterTypes(t *testing.T) {
+	assert.NoError(t, tracing.ValidateExporterTypes([]string{"console", "otlp"}))
+	assert.Error(t, tracing.ValidateExporterTypes(nil))
+	assert.Error(t, tracing.ValidateExporterTypes([]string{"console", "zipkin"}))
+	assert.Error(t, tracing.ValidateExporterTypes([]string{"console", "console"}))
+}
+
+func TestRequiredHeaders(t *testing.T) {
+	recorder := setupSpanRecorder(t)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.TracingMiddleware(tracing.ServiceName))
+	api := router.Group("/api")
+	api.Use(middleware.RequiredHeaders("X-Client-Version", "X-Client-Name"))
+	api.GET("/users", func(c *gin.Context) { c.Status(200) })
+
+	// All required headers present
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/users", nil)
+	req.Header.Set("X-Client-Version", "1.2.3")
+	req.Header.Set("X-Client-Name", "web")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	// Missing header is listed in the response and recorded on the span
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users", nil)
+	req.Header.Set("X-Client-Name", "web")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "Missing required headers: X-Client-Version", response["message"])
+
+	spans := recorder.Ended()
+	lastSpan := spans[len(spans)-1]
+	var missing []string
+	for _, attr := range lastSpan.Attributes() {
+		if attr.Key == "http.request.missing_headers" {
+			missing = attr.Value.AsStringSlice()
+		}
+	}
+	assert.Equal(t, []string{"X-Client-Version"}, missing)
+
+	// Rejections honor ERROR_FORMAT
+	utils.SetErrorFormat(utils.ErrorFormatProblem)
+	defer utils.SetErrorFormat(utils.ErrorFormatEnvelope)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users", nil)
+	router.ServeHTTP(w, req)
+	assertProblemResponse(t, w, 400, "Missing required headers: X-Client-Version, X-Client-Name")
+}
+
+// fakeGeocoder returns fixed coordinates or an error
+type fakeGeocoder struct {
+	lat, lng float64
+	err      error
+}
+
+func (g fakeGeocoder) Geocode(ctx context.Context, address models.Address) (float64, float64, error) {
+	return g.lat, g.lng, g.err
+}
+
+func TestCreateUserGeocoding(t *testing.T) {
+	ctx := context.Background()
+	address := func() *models.Address {
+		return &models.Address{Street: "1 Silom Rd", City: "Bangkok", Country: "TH"}
+	}
+
+	// Coordinates from the geocoder are stored
+	userService, err := services.NewUserServiceWithConfig(repository.NewInMemoryUserRepository(), services.UserServiceConfig{
+		Geocoder: fakeGeocoder{lat: 13.7563, lng: 100.5018},
+	})
+	assert.NoError(t, err)
+	user, err := userService.CreateUser(ctx, models.CreateUserRequest{FirstName: "Geo", LastName: "User", Email: "geo@example.com", Address: address()})
+	assert.NoError(t, err)
+	assert.InDelta(t, 13.7563, *user.Address.Latitude, 1e-9)
+	assert.InDelta(t, 100.5018, *user.Address.Longitude, 1e-9)
+
+	// Bulk upserts are geocoded too
+	results, err := userService.BulkUpsertUsers(ctx, []models.CreateUserRequest{{FirstName: "Bulk", LastName: "User", Email: "bulk.geo@example.com", Address: address()}})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) && assert.NotNil(t, results[0].User) {
+		assert.InDelta(t, 13.7563, *results[0].User.Address.Latitude, 1e-9)
+	}
+
+	// Coordinates sent by clients are read-only and dropped on create and update
+	clientCoords := func() *models.Address {
+		lat, lng := 51.5, -0.12
+		a := address()
+		a.Latitude, a.Longitude = &lat, &lng
+		return a
+	}
+	plainService := services.NewUserService(repository.NewInMemoryUserRepository())
+	user, err = plainService.CreateUser(ctx, models.CreateUserRequest{FirstName: "Geo", LastName: "User", Email: "client.geo@example.com", Address: clientCoords()})
+	assert.NoError(t, err)
+	assert.Nil(t, user.Address.Latitude)
+	assert.Nil(t, user.Address.Longitude)
+	user, err = plainService.UpdateUser(ctx, user.ID, models.UpdateUserRequest{FirstName: "Geo", LastName: "User", Email: "client.geo@example.com", Address: clientCoords()})
+	assert.NoError(t, err)
+	assert.Nil(t, user.Address.Latitude)
+	assert.Nil(t, user.Address.Longitude)
+
+	// Geocoding failures don't fail the request
+	userService, err = services.NewUserServiceWithConfig(repository.NewInMemoryUserRepository(), services.UserServiceConfig{
+		Geocoder: fakeGeocoder{err: fmt.Errorf("geocoder unavailable")},
+	})
+	assert.NoError(t, err)
+	user, err = userService.CreateUser(ctx, models.CreateUserRequest{FirstName: "Geo", LastName: "User", Email: "geo@example.com", Address: address()})
+	assert.NoError(t, err)
+	assert.Nil(t, user.Address.Latitude)
+
+	// The default no-op geocoder leaves coordinates unset
+	user, err = services.NewUserService(repository.NewInMemoryUserRepository()).CreateUser(ctx, models.CreateUserRequest{FirstName: "Geo", LastName: "User", Email: "geo@example.com", Address: address()})
+	assert.NoError(t, err)
+	assert.Nil(t, user.Address.Latitude)
+}
+
+func TestConditionalCreateUser(t *testing.T) {
+	router := setupTestRouter()
+
+	post := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(models.CreateUserRequest{FirstName: "Cond", LastName: "User", Email: "cond@example.com"})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// New user is created
+	w := post("/api/users?if_not_exists=true", nil)
+	assert.Equal(t, 201, w.Code)
+	var created map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	id := created["data"].(map[string]interface{})["id"]
+
+	// Existing user is returned with the query flag
+	w = post("/api/users?if_not_exists=true", nil)
+	assert.Equal(t, 200, w.Code)
+	var existing map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &existing)
+	assert.Equal(t, id, existing["data"].(map[string]interface{})["id"])
+
+	// Existing user is returned with If-None-Match: *
+	w = post("/api/users", map[string]string{"If-None-Match": "*"})
+	assert.Equal(t, 200, w.Code)
+
+	// Default behavior is still a conflict
+	w = post("/api/users", nil)
+	assert.Equal(t, 409, w.Code)
+}
+
+func TestRepositoryStats(t *testing.T) {
+	userRepo := repository.NewInMemoryUserRepository()
+	ctx := context.Background()
+
+	stats, err := userRepo.Stats(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "memory", stats.Backend)
+	assert.Equal(t, 0, stats.UserCount)
+
+	userRepo.Create(ctx, models.NewUser(models.CreateUserRequest{FirstName: "Stat", LastName: "One", Email: "stat1@example.com"}))
+	userRepo.Create(ctx, models.NewUser(models.CreateUserRequest{FirstName: "Stat", LastName: "Two", Email: "stat2@example.com"}))
+
+	stats, err = userRepo.Stats(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.UserCount)
+	assert.Greater(t, stats.Details["approx_memory_bytes"], 0)
+
+	// Exposed over HTTP
+	router := setupTestRouter()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/stats", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(t, "memory", data["backend"])
+	assert.Equal(t, float64(0), data["user_count"])
+}
+
+func TestStrictEmailValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		strict  bool
+		email   string
+		wantErr bool
+	}{
+		{name: "plain address", strict: true, email: "alice@example.com"},
+		{name: "display name rejected when strict", strict: true, email: "Alice <alice@example.com>", wantErr: true},
+		{name: "comment rejected when strict", strict: true, email: "alice@example.com (work)", wantErr: true},
+		{name: "invalid address", strict: true, email: "alice..smith@example.com", wantErr: true},
+		{name: "plain address without strict", strict: false, email: "alice@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userService, err := services.NewUserServiceWithConfig(repository.NewInMemoryUserRepository(), services.UserServiceConfig{
+				StrictEmail: tt.strict,
+			})
+			assert.NoError(t, err)
+
+			_, err = userService.CreateUser(context.Background(), models.CreateUserRequest{
+				FirstName: "Alice",
+				LastName:  "Smith",
+				Email:     tt.email,
+			})
+			if tt.wantErr {
+				var validationErr *services.ValidationError
+				assert.ErrorAs(t, err, &validationErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestStrictEmailValidationConfig(t *testing.T) {
+	t.Setenv("EMAIL_STRICT_VALIDATION", "true")
+	assert.True(t, loadUserServiceConfig(t).StrictEmail)
+
+	// A typo is returned to the caller rather than silently disabling strict validation
+	t.Setenv("EMAIL_STRICT_VALIDATION", "ture")
+	_, err := services.LoadUserServiceConfigFromEnv()
+	assert.ErrorContains(t, err, "EMAIL_STRICT_VALIDATION")
+}
+
+func TestClientAttribution(t *testing.T) {
+	recorder := setupSpanRecorder(t)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.TracingMiddleware(tracing.ServiceName))
+	router.Use(middleware.ClientAttribution("ios-app", "user-api-go"))
+	router.GET("/ping", func(c *gin.Context) { c.Status(200) })
+
+	tests := []struct {
+		name        string
+		headers     map[string]string
+		wantName    string
+		wantVersion string
+		wantBucket  string
+	}{
+		{
+			name:        "client headers",
+			headers:     map[string]string{"X-Client-Name": "iOS-App", "X-Client-Version": "2.1.0"},
+			wantName:    "ios-app",
+			wantVersion: "2.1.0",
+			wantBucket:  "ios-app",
+		},
+		{
+			name:        "user agent fallback",
+			headers:     map[string]string{"User-Agent": "user-api-go/1.4.0 (linux; amd64)"},
+			wantName:    "user-api-go",
+			wantVersion: "1.4.0",
+			wantBucket:  "user-api-go",
+		},
+		{
+			name:        "unknown client is bucketed",
+			headers:     map[string]string{"User-Agent": "curl/8.4.0"},
+			wantName:    "curl",
+			wantVersion: "8.4.0",
+			wantBucket:  "other",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/ping", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			router.ServeHTTP(w, req)
+			assert.Equal(t, 200, w.Code)
+
+			ended := recorder.Ended()
+			span := ended[len(ended)-1]
+			attrs := make(map[attribute.Key]string)
+			for _, attr := range span.Attributes() {
+				attrs[attr.Key] = attr.Value.Emit()
+			}
+			assert.Equal(t, tt.wantName, attrs["client.name"])
+			assert.Equal(t, tt.wantVersion, attrs["client.version"])
+			assert.Equal(t, tt.wantBucket, attrs["client.bucket"])
+		})
+	}
+}
+
+func TestDeeplyNestedJSONRejected(t *testing.T) {
+	router := setupTestRouter()
+
+	depth := utils.DefaultMaxJSONDepth + 1
+	body := `{"first_name":"John","last_name":"Doe","email":"nested@example.com","address":` +
+		strings.Repeat(`{"street":`, depth) + `"x"` + strings.Repeat("}", depth) + "}"
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/users", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "maximum JSON nesting depth")
+}
+
+func TestCreateUserCancelledContext(t *testing.T) {
+	userRepo := repository.NewInMemoryUserRepository()
+	userService := services.NewUserService(userRepo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	user, err := userService.CreateUser(ctx, models.CreateUserRequest{
+		FirstName: "Gone",
+		LastName:  "Away",
+		Email:     "gone@example.com",
+	})
+	assert.Nil(t, user)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Nothing was persisted
+	users, err := userRepo.GetAll(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+
+	// The handler maps the cancellation to 499
+	router := setupTestRouter()
+	jsonData, _ := json.Marshal(models.CreateUserRequest{FirstName: "Gone", LastName: "Away", Email: "gone@example.com"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(ctx, "POST", "/api/users", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, utils.StatusClientClosedRequest, w.Code)
+}
+
+func TestSpanAttributeAllowlist(t *testing.T) {
+	recorder := setupSpanRecorder(t)
+	tracing.SetAttributeAllowlist([]string{"user.id"})
+	defer tracing.SetAttributeAllowlist(nil)
+
+	_, span := tracing.GetTracer("test").Start(context.Background(), "allowlist.span")
+	tracing.AddSpanAttributes(span,
+		tracing.AttrUserID.String("123"),
+		attribute.String("user.first_name", "John"),
+	)
+	tracing.AddSpanEvent(span, "user.created",
+		tracing.AttrUserID.String("123"),
+		tracing.AttrUserEmail.String("john@example.com"),
+	)
+	span.End()
+
+	recorded := findSpan(recorder, "allowlist.span")
+	assert.NotNil(t, recorded)
+	keys := make([]attribute.Key, 0, len(recorded.Attributes()))
+	for _, attr := range recorded.Attributes() {
+		keys = append(keys, attr.Key)
+	}
+	assert.Contains(t, keys, tracing.AttrUserID)
+	assert.NotContains(t, keys, attribute.Key("user.first_name"))
+
+	// Event attributes go through the same allowlist
+	if assert.Len(t, recorded.Events(), 1) {
+		event := recorded.Events()[0]
+		assert.Equal(t, []attribute.KeyValue{tracing.AttrUserID.String("123")}, event.Attributes)
+	}
+}
+
+func TestGetUserSchema(t *testing.T) {
+	router := setupTestRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/users/schema", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	var response struct {
+		Data []models.FieldSchema `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	fields := make(map[string]models.FieldSchema)
+	for _, field := range response.Data {
+		fields[field.Name] = field
+	}
+
+	firstName := fields["first_name"]
+	assert.Equal(t, "string", firstName.Type)
+	assert.True(t, firstName.Required)
+	assert.Equal(t, 2, *firstName.Min)
+	assert.Equal(t, 50, *firstName.Max)
+
+	assert.Equal(t, "email", fields["email"].Format)
+	assert.False(t, fields["phone"].Required)
+	assert.Equal(t, "date", fields["date_of_birth"].Format)
+	assert.Equal(t, "object", fields["address"].Type)
+	assert.NotEmpty(t, fields["address"].Fields)
+}
+
+// failingExporter is a span exporter whose exports always fail
+type failingExporter struct{}
+
+func (failingExporter) ExportSpans(context.Context, []sdktrace.ReadOnlySpan) error {
+	return errors.New("collector unreachable")
+}
+
+func (failingExporter) Shutdown(context.Context) error { return nil }
+
+func TestDeadLetterExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	exporter := tracing.NewDeadLetterExporter(failingExporter{}, path)
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(context.Background())
+
+	_, span := tp.Tracer("test").Start(context.Background(), "dead.letter.span")
+	span.End()
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 1)
+
+	var stub map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &stub))
+	assert.Equal(t, "dead.letter.span", stub["Name"])
+	assert.Equal(t, span.SpanContext().TraceID().String(), stub["SpanContext"].(map[string]interface{})["TraceID"])
+}
+
+func TestValidateUsers(t *testing.T) {
+	router := setupTestRouter()
+
+	reqs := []models.CreateUserRequest{
+		{FirstName: "Valid", LastName: "User", Email: "valid@example.com"},
+		{FirstName: "X", LastName: "User", Email: "not-an-email", Address: &models.Address{City: strings.Repeat("a", 51)}},
+	}
+	jsonData, _ := json.Marshal(reqs)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/users/validate", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	var response struct {
+		Data []models.ValidationResult `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Data, 2)
+
+	assert.True(t, response.Data[0].Valid)
+	assert.Empty(t, response.Data[0].Errors)
+
+	assert.False(t, response.Data[1].Valid)
+	errorsByField := make(map[string]models.FieldError)
+	for _, fieldErr := range response.Data[1].Errors {
+		errorsByField[fieldErr.Field] = fieldErr
+	}
+	assert.Equal(t, "min", errorsByField["first_name"].Tag)
+	assert.Equal(t, "FirstName must be at least 2 characters long", errorsByField["first_name"].Message)
+	assert.Equal(t, "email", errorsByField["email"].Tag)
+	assert.Equal(t, "max", errorsByField["address.city"].Tag)
+
+	// Nothing was persisted
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users", nil)
+	router.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), `"data":[]`)
+}
+
+func TestInflightRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.Inflight(true))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router.GET("/block", func(c *gin.Context) {
+		close(started)
+		<-release
+		c.Status(200)
+	})
+	router.GET("/ping", func(c *gin.Context) { c.Status(200) })
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req, _ := http.NewRequest("GET", "/block", nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	<-started
+
+	// The blocked request is counted alongside the concurrent one
+	assert.Equal(t, int64(1), middleware.InflightRequests())
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ping", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "2", w.Header().Get("X-Inflight"))
+
+	close(release)
+	<-done
+	assert.Equal(t, int64(0), middleware.InflightRequests())
+}
+
+func TestTimedEvent(t *testing.T) {
+	recorder := setupSpanRecorder(t)
+
+	userService := services.NewUserService(repository.NewInMemoryUserRepository())
+	_, err := userService.CreateUser(context.Background(), models.CreateUserRequest{
+		FirstName: "Timed",
+		LastName:  "Event",
+		Email:     "timed@example.com",
+	})
+	assert.NoError(t, err)
+
+	span := findSpan(recorder, "UserService.CreateUser")
+	assert.NotNil(t, span)
+
+	var events []string
+	for _, event := range span.Events() {
+		events = append(events, event.Name)
+	}
+	assert.Subset(t, events, []string{"validation.start", "validation.success", "email_check.start", "email_check.success"})
+
+	attrs := make(map[attribute.Key]bool)
+	for _, attr := range span.Attributes() {
+		attrs[attr.Key] = true
+	}
+	assert.True(t, attrs["validation.duration_ms"])
+	assert.True(t, attrs["email_check.duration_ms"])
+
+	// Failures record a failure event and the error
+	_, span2 := tracing.GetTracer("test").Start(context.Background(), "timed.failure")
+	err = tracing.TimedEvent(span2, "phase", func() error { return errors.New("boom") })
+	span2.End()
+	assert.EqualError(t, err, "boom")
+
+	failed := findSpan(recorder, "timed.failure")
+	assert.Equal(t, codes.Error, failed.Status().Code)
+	var failureEvents []string
+	for _, event := range failed.Events() {
+		failureEvents = append(failureEvents, event.Name)
+	}
+	assert.Contains(t, failureEvents, "phase.failure")
+}
+
+func TestGetUsersIDsFormat(t *testing.T) {
+	router := setupTestRouter()
+
+	var createdIDs []string
+	for i := 0; i < 3; i++ {
+		jsonData, _ := json.Marshal(models.CreateUserRequest{FirstName: "Id", LastName: "Only", Email: fmt.Sprintf("ids%d@example.com", i)})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 201, w.Code)
+
+		var created map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &created)
+		createdIDs = append(createdIDs, created["data"].(map[string]interface{})["id"].(string))
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/users?format=ids", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	var response struct {
+		Data       []string         `json:"data"`
+		Pagination utils.Pagination `json:"pagination"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.ElementsMatch(t, createdIDs, response.Data)
+	assert.Equal(t, 3, response.Pagination.Total)
+
+	// Pagination still applies
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users?format=ids&page=2&limit=2", nil)
+	router.ServeHTTP(w, req)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Data, 1)
+
+	// Unknown formats are rejected
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users?format=xml", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestAPIVersioning(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api := router.Group("/api")
+	api.Use(middleware.APIVersioning("1", "1", "2"))
+	api.GET("/version", func(c *gin.Context) {
+		c.String(200, middleware.GetAPIVersion(c))
+	})
+
+	tests := []struct {
+		name        string
+		headers     map[string]string
+		wantCode    int
+		wantVersion string
+	}{
+		{name: "default when absent", wantCode: 200, wantVersion: "1"},
+		{name: "supported header", headers: map[string]string{"X-API-Version": "2"}, wantCode: 200, wantVersion: "2"},
+		{name: "accept version parameter", headers: map[string]string{"Accept": "application/json; version=2"}, wantCode: 200, wantVersion: "2"},
+		{name: "unsupported version", headers: map[string]string{"X-API-Version": "3"}, wantCode: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/api/version", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode == 200 {
+				assert.Equal(t, tt.wantVersion, w.Body.String())
+			} else {
+				assert.Contains(t, w.Body.String(), "Unsupported API version: 3")
+			}
+		})
+	}
+
+	// Rejections honor ERROR_FORMAT
+	utils.SetErrorFormat(utils.ErrorFormatProblem)
+	defer utils.SetErrorFormat(utils.ErrorFormatEnvelope)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/version", nil)
+	req.Header.Set("X-API-Version", "3")
+	router.ServeHTTP(w, req)
+	assertProblemResponse(t, w, 400, "Unsupported API version: 3 (supported: 1, 2)")
+}
+
+func TestUserIDsSerializeAsStrings(t *testing.T) {
+	// IDs must stay JSON strings so JavaScript clients never lose precision
+	user := models.NewUser(models.CreateUserRequest{FirstName: "String", LastName: "Id", Email: "string.id@example.com"})
+	response := user.ToResponse()
+
+	for name, value := range map[string]interface{}{
+		"user":     user,
+		"response": response,
+		"bulk":     models.BulkUpsertResult{User: &response},
+	} {
+		data, err := json.Marshal(value)
+		assert.NoError(t, err)
+
+		var decoded map[string]interface{}
+		assert.NoError(t, json.Unmarshal(data, &decoded))
+		if name == "bulk" {
+			decoded = decoded["user"].(map[string]interface{})
+		}
+		assert.IsType(t, "", decoded["id"], name)
+	}
+}
+
+func TestIDChecksum(t *testing.T) {
+	models.SetIDChecksum(true)
+	defer models.SetIDChecksum(false)
+
+	user := models.NewUser(models.CreateUserRequest{FirstName: "Check", LastName: "Sum", Email: "checksum@example.com"})
+	external := user.ToResponse().ID
+	assert.True(t, strings.HasPrefix(external, user.ID+"."))
+	assert.Equal(t, external, models.ExternalID(user.ID))
+
+	// The suffixed ID is still a JSON string
+	data, _ := json.Marshal(user.ToResponse())
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, external, decoded["id"])
+
+	id, err := models.ParseExternalID(external)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, id)
+
+	tampered := external[:len(external)-1] + "x"
+	for _, value := range []string{user.ID, tampered, "other-id" + external[len(user.ID):]} {
+		_, err := models.ParseExternalID(value)
+		assert.ErrorIs(t, err, models.ErrInvalidIDChecksum, value)
+	}
+
+	// Path parameters are verified and stripped before the ID pattern check
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/users/:id", middleware.ValidateIDParam("id", middleware.UUIDPattern), func(c *gin.Context) {
+		c.String(200, c.Param("id"))
+	})
+	for value, want := range map[string]int{external: 200, user.ID: 400, tampered: 400} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/users/"+value, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, want, w.Code, value)
+		if want == 200 {
+			assert.Equal(t, user.ID, w.Body.String())
+		}
+	}
+
+	// Disabled, IDs pass through unchanged
+	models.SetIDChecksum(false)
+	assert.Equal(t, user.ID, user.ToResponse().ID)
+	id, err = models.ParseExternalID(user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, id)
+
+	t.Setenv("ID_CHECKSUM", "true")
+	assert.True(t, loadConfig(t).IDChecksum)
+}
+
+func TestDBOperationCounter(t *testing.T) {
+	userRepo := repository.NewInMemoryUserRepository()
+	userService := services.NewUserService(userRepo)
+
+	// A single create is one repository operation
+	ctx := repository.WithOperationCounter(context.Background())
+	userRepo.Create(ctx, models.NewUser(models.CreateUserRequest{FirstName: "Count", LastName: "One", Email: "count1@example.com"}))
+	count, ok := repository.OperationCount(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), count)
+
+	// A bulk create performs one operation per item
+	ctx = repository.WithOperationCounter(context.Background())
+	_, err := userService.BulkUpsertUsers(ctx, []models.CreateUserRequest{
+		{FirstName: "Bulk", LastName: "One", Email: "bulk1@example.com"},
+		{FirstName: "Bulk", LastName: "Two", Email: "bulk2@example.com"},
+		{FirstName: "Bulk", LastName: "Three", Email: "bulk3@example.com"},
+	})
+	assert.NoError(t, err)
+	count, _ = repository.OperationCount(ctx)
+	assert.Equal(t, int64(3), count)
+
+	// The middleware records the count on the request span and in the log line
+	recorder := setupSpanRecorder(t)
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.Logger(logging.LoggingConfig{}))
+	router.Use(middleware.TracingMiddleware(tracing.ServiceName))
+	router.Use(middleware.DBOperationCounter())
+	router.GET("/api/users/:id", handlers.NewUserHandler(userService).GetUser)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/users/missing", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+
+	span := findSpan(recorder, "/api/users/:id")
+	assert.NotNil(t, span)
+	var spanCount int64
+	for _, attr := range span.Attributes() {
+		if attr.Key == "db.operation.count" {
+			spanCount = attr.Value.AsInt64()
+		}
+	}
+	assert.Equal(t, int64(1), spanCount)
+	assert.Contains(t, logBuf.String(), "db_ops=1")
+}
+
+func TestSafeMethodGuard(t *testing.T) {
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+
+	userRepo := repository.NewInMemoryUserRepository()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.SafeMethodGuard(func(ctx context.Context) (int, error) {
+		stats, err := userRepo.Stats(ctx)
+		return stats.UserCount, err
+	}))
+	router.GET("/well-behaved", func(c *gin.Context) {
+		userRepo.GetAll(c.Request.Context())
+		c.Status(200)
+	})
+	router.GET("/misbehaving", func(c *gin.Context) {
+		userRepo.Create(c.Request.Context(), models.NewUser(models.CreateUserRequest{FirstName: "Side", LastName: "Effect", Email: "side.effect@example.com"}))
+		c.Status(200)
+	})
+
+	req, _ := http.NewRequest("GET", "/well-behaved", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.NotContains(t, logBuf.String(), "safe method")
+
+	req, _ = http.NewRequest("GET", "/misbehaving", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Contains(t, logBuf.String(), "ERROR: safe method GET /misbehaving changed state (user count 0 -> 1)")
+}
+
+func TestDomainCreateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	userService, err := services.NewUserServiceWithConfig(repository.NewInMemoryUserRepository(), services.UserServiceConfig{
+		DomainCreateLimit:  3,
+		DomainCreateWindow: time.Hour,
+	})
+	assert.NoError(t, err)
+	router := gin.New()
+	router.POST("/api/users", handlers.NewUserHandler(userService).CreateUser)
+
+	create := func(email string) int {
+		jsonData, _ := json.Marshal(models.CreateUserRequest{FirstName: "Rate", LastName: "Limited", Email: email})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, 201, create(fmt.Sprintf("user%d@spam.example.com", i)))
+	}
+	assert.Equal(t, 429, create("user3@spam.example.com"))
+	assert.Equal(t, 429, create("user4@SPAM.example.com"))
+
+	// Other domains are unaffected
+	assert.Equal(t, 201, create("user0@other.example.com"))
+}
+
+func TestReadinessCheckers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	readiness := health.NewReadiness()
+	assert.NoError(t, readiness.SetReady())
+
+	userRepo := repository.NewInMemoryUserRepository()
+	checks := health.NewRegistry()
+	checks.Register(health.NewCheckFunc("repository", userRepo.Ping))
+
+	router := gin.New()
+	router.GET("/readyz", handlers.NewHealthHandler(readiness, checks).Readiness)
+
+	getReadyz := func() (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/readyz", nil)
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response["checks"].(map[string]interface{})
+	}
+
+	// All checks passing
+	code, results := getReadyz()
+	assert.Equal(t, 200, code)
+	assert.Equal(t, "ok", results["repository"].(map[string]interface{})["status"])
+
+	// One failing check fails readiness
+	checks.Register(health.NewCheckFunc("collector", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}))
+	code, results = getReadyz()
+	assert.Equal(t, 503, code)
+	assert.Equal(t, "ok", results["repository"].(map[string]interface{})["status"])
+	collector := results["collector"].(map[string]interface{})
+	assert.Equal(t, "error", collector["status"])
+	assert.Equal(t, "connection refused", collector["error"])
+}
+
+func TestBulkUpsertStatusCodes(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		batch       []models.CreateUserRequest
+		wantCode    int
+		wantPartial string
+		wantSummary utils.Summary
+	}{
+		{
+			name: "all success",
+			batch: []models.CreateUserRequest{
+				{FirstName: "Good", LastName: "One", Email: "good1@example.com"},
+				{FirstName: "Good", LastName: "Two", Email: "good2@example.com"},
+			},
+			wantCode:    200,
+			wantSummary: utils.Summary{Succeeded: 2},
+		},
+		{
+			name: "all fail",
+			batch: []models.CreateUserRequest{
+				{FirstName: "", LastName: "One", Email: "bad1@example.com"},
+				{FirstName: "Bad", LastName: "Two", Email: "not-an-email"},
+			},
+			wantCode:    207,
+			wantSummary: utils.Summary{Failed: 2},
+		},
+		{
+			name: "mixed",
+			batch: []models.CreateUserRequest{
+				{FirstName: "Good", LastName: "One", Email: "good1@example.com"},
+				{FirstName: "", LastName: "Two", Email: "bad2@example.com"},
+			},
+			wantCode:    207,
+			wantPartial: "true",
+			wantSummary: utils.Summary{Succeeded: 1, Failed: 1},
+		},
+		{
+			name: "mixed with ok mode",
+			mode: utils.BatchStatusOK,
+			batch: []models.CreateUserRequest{
+				{FirstName: "Good", LastName: "One", Email: "good1@example.com"},
+				{FirstName: "", LastName: "Two", Email: "bad2@example.com"},
+			},
+			wantCode:    200,
+			wantPartial: "true",
+			wantSummary: utils.Summary{Succeeded: 1, Failed: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			utils.SetBatchStatusMode(tt.mode)
+			defer utils.SetBatchStatusMode(utils.BatchStatusMultiStatus)
+
+			router := setupTestRouter()
+			jsonData, _ := json.Marshal(tt.batch)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("PUT", "/api/users/bulk", bytes.NewBuffer(jsonData))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantPartial, w.Header().Get("X-Partial-Success"))
+
+			var response struct {
+				Summary utils.Summary `json:"summary"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.wantSummary, response.Summary)
+		})
+	}
+}
+
+func TestRequestNormalization(t *testing.T) {
+	raw := models.CreateUserRequest{
+		FirstName: "  mARY   anne ",
+		LastName:  "o'brien",
+		Email:     " Mary.OBrien@Example.COM ",
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		userService, err := services.NewUserServiceWithConfig(repository.NewInMemoryUserRepository(), services.UserServiceConfig{
+			Normalization: services.NormalizationConfig{
+				CollapseWhitespace: true,
+				TitleCaseNames:     true,
+				LowercaseEmail:     true,
+			},
+		})
+		assert.NoError(t, err)
+
+		user, err := userService.CreateUser(context.Background(), raw)
+		assert.NoError(t, err)
+		assert.Equal(t, "Mary Anne", user.FirstName)
+		assert.Equal(t, "O'brien", user.LastName)
+		assert.Equal(t, "mary.obrien@example.com", user.Email)
+
+		// Lookups by email are normalized the same way
+		found, err := userService.GetUserByEmail(context.Background(), "MARY.OBRIEN@example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, found.ID)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		userService, err := services.NewUserServiceWithConfig(repository.NewInMemoryUserRepository(), services.UserServiceConfig{
+			Normalization: services.NormalizationConfig{DisableTrim: true},
+		})
+		assert.NoError(t, err)
+
+		req := raw
+		req.Email = "Mary.OBrien@Example.COM"
+		user, err := userService.CreateUser(context.Background(), req)
+		assert.NoError(t, err)
+		assert.Equal(t, "  mARY   anne ", user.FirstName)
+		assert.Equal(t, "o'brien", user.LastName)
+		assert.Equal(t, "Mary.OBrien@Example.COM", user.Email)
+	})
+
+	t.Run("zero value trims", func(t *testing.T) {
+		userService, err := services.NewUserServiceWithConfig(repository.NewInMemoryUserRepository(), services.UserServiceConfig{})
+		assert.NoError(t, err)
+
+		user, err := userService.CreateUser(context.Background(), raw)
+		assert.NoError(t, err)
+		assert.Equal(t, "mARY   anne", user.FirstName)
+		assert.Equal(t, "Mary.OBrien@Example.COM", user.Email)
+	})
+
+	t.Run("environment", func(t *testing.T) {
+		var logBuf bytes.Buffer
+		log.SetOutput(&logBuf)
+		defer log.SetOutput(os.Stderr)
+
+		t.Setenv("NORMALIZE_TRIM", "false")
+		assert.True(t, loadUserServiceConfig(t).Normalization.DisableTrim)
+
+		// Invalid values keep the default and are logged
+		t.Setenv("NORMALIZE_TRIM", "sometimes")
+		assert.False(t, loadUserServiceConfig(t).Normalization.DisableTrim)
+		assert.Contains(t, logBuf.String(), `Invalid value for NORMALIZE_TRIM: "sometimes"`)
+	})
+}
+
+func TestCreateUserTransformations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	userService, err := services.NewUserServiceWithConfig(repository.NewInMemoryUserRepository(), services.UserServiceConfig{
+		Normalization: services.NormalizationConfig{LowercaseEmail: true},
+	})
+	assert.NoError(t, err)
+	router := gin.New()
+	router.POST("/api/users", handlers.NewUserHandler(userService).CreateUser)
+
+	create := func(url string, req models.CreateUserRequest) map[string]interface{} {
+		jsonData, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+		httpReq.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, httpReq)
+		assert.Equal(t, 201, w.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response["data"].(map[string]interface{})
+	}
+
+	// Verbose responses list the applied changes
+	data := create("/api/users?verbose=true", models.CreateUserRequest{FirstName: " Ann ", LastName: "Lee", Email: "Ann.Lee@Example.com"})
+	assert.Equal(t, []interface{}{"first_name was trimmed", "email was lowercased"}, data["transformations"])
+
+	// Omitted unless requested
+	data = create("/api/users", models.CreateUserRequest{FirstName: " Bob ", LastName: "Lee", Email: "Bob.Lee@Example.com"})
+	assert.NotContains(t, data, "transformations")
+}
+
+func TestIPFilter(t *testing.T) {
+	allow, err := middleware.ParseCIDRs([]string{"10.0.0.0/8"})
+	assert.NoError(t, err)
+	deny, err := middleware.ParseCIDRs([]string{"10.0.0.66"})
+	assert.NoError(t, err)
+
+	_, err = middleware.ParseCIDRs([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.IPFilter(allow, deny))
+	router.GET("/ping", func(c *gin.Context) { c.Status(200) })
+
+	tests := []struct {
+		remoteAddr string
+		wantCode   int
+	}{
+		{remoteAddr: "10.1.2.3:1234", wantCode: 200},
+		{remoteAddr: "10.0.0.66:1234", wantCode: 403},
+		{remoteAddr: "192.168.1.1:1234", wantCode: 403},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		req.RemoteAddr = tt.remoteAddr
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tt.wantCode, w.Code, tt.remoteAddr)
+	}
+
+	// Rejections honor ERROR_FORMAT
+	utils.SetErrorFormat(utils.ErrorFormatProblem)
+	defer utils.SetErrorFormat(utils.ErrorFormatEnvelope)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ping", nil)
+	req.RemoteAddr = "10.0.0.66:1234"
+	router.ServeHTTP(w, req)
+	assertProblemResponse(t, w, 403, "Access denied")
+}
+
+func TestTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.1, 10.1.0.0/16")
+	cfg := loadConfig(t)
+	assert.Equal(t, []string{"10.0.0.1", "10.1.0.0/16"}, cfg.TrustedProxies)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	assert.NoError(t, router.SetTrustedProxies(cfg.TrustedProxies))
+	router.GET("/ip", func(c *gin.Context) { c.String(200, c.ClientIP()) })
+
+	clientIP := func(remoteAddr string) string {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ip", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	// Forwarded header from a trusted proxy is honored
+	assert.Equal(t, "203.0.113.7", clientIP("10.0.0.1:1234"))
+	assert.Equal(t, "203.0.113.7", clientIP("10.1.5.5:1234"))
+
+	// Spoofed header from an untrusted source is ignored
+	assert.Equal(t, "192.0.2.10", clientIP("192.0.2.10:1234"))
+
+	// Loopback is trusted by default
+	t.Setenv("TRUSTED_PROXIES", "")
+	assert.Equal(t, []string{"127.0.0.1", "::1"}, loadConfig(t).TrustedProxies)
+
+	assert.Error(t, gin.New().SetTrustedProxies([]string{"not-an-ip"}))
+}
+
+func TestFindDuplicates(t *testing.T) {
+	router := setupTestRouter()
+
+	seed := []models.CreateUserRequest{
+		{FirstName: "Jonathan", LastName: "Smith", Email: "jon.smith@example.com", Phone: "+1 555 010 0001"},
+		{FirstName: "Jonathon", LastName: "Smith", Email: "jsmith@example.org"},
+		{FirstName: "Alice", LastName: "Walker", Email: "alice@example.com", Phone: "15550100002"},
+		{FirstName: "Alicia", LastName: "Keys", Email: "akeys@example.com", Phone: "1-555-010-0002"},
+		{FirstName: "Unique", LastName: "Person", Email: "unique@example.com"},
+	}
+	for _, user := range seed {
+		jsonData, _ := json.Marshal(user)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 201, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/users/duplicates", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	var response struct {
+		Data []models.DuplicateGroup `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Data, 2)
+
+	emailsOf := func(group models.DuplicateGroup) []string {
+		var emails []string
+		for _, user := range group.Users {
+			emails = append(emails, user.Email)
+		}
+		return emails
+	}
+
+	// Near-identical names
+	assert.Equal(t, []string{"name"}, response.Data[0].Reasons)
+	assert.Equal(t, []string{"jon.smith@example.com", "jsmith@example.org"}, emailsOf(response.Data[0]))
+
+	// Same phone digits despite different formatting
+	assert.Equal(t, []string{"phone"}, response.Data[1].Reasons)
+	assert.Equal(t, []string{"alice@example.com", "akeys@example.com"}, emailsOf(response.Data[1]))
+}
+
+func TestRequireAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		require bool
+		address *models.Address
+		wantErr string
+	}{
+		{name: "optional without address", require: false},
+		{name: "required and missing", require: true, wantErr: "Address is required"},
+		{name: "required without country", require: true, address: &models.Address{City: "Bangkok"}, wantErr: "Country is required"},
+		{name: "required and complete", require: true, address: &models.Address{City: "Bangkok", Country: "TH"}},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userService, err := services.NewUserServiceWithConfig(repository.NewInMemoryUserRepository(), services.UserServiceConfig{
+				RequireAddress: tt.require,
+			})
+			assert.NoError(t, err)
+
+			_, err = userService.CreateUser(context.Background(), models.CreateUserRequest{
+				FirstName: "Addr",
+				LastName:  "Check",
+				Email:     fmt.Sprintf("addr%d@example.com", i),
+				Address:   tt.address,
+			})
+			if tt.wantErr != "" {
+				var validationErr *services.ValidationError
+				assert.ErrorAs(t, err, &validationErr)
+				assert.Equal(t, tt.wantErr, err.Error())
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestHTTPResponseAttributes(t *testing.T) {
+	toMap := func(attrs []attribute.KeyValue) map[attribute.Key]attribute.Value {
+		values := make(map[attribute.Key]attribute.Value)
+		for _, attr := range attrs {
+			values[attr.Key] = attr.Value
+		}
+		return values
+	}
+
+	ok := toMap(tracing.HTTPResponseAttributes(200, 128))
+	assert.Equal(t, int64(200), ok[tracing.AttrHTTPStatusCode].AsInt64())
+	assert.Equal(t, int64(128), ok[tracing.AttrResponseSize].AsInt64())
+	assert.False(t, ok[tracing.AttrHTTPError].AsBool())
+	assert.NotContains(t, ok, tracing.AttrErrorType)
+
+	failed := toMap(tracing.HTTPResponseAttributes(500, 64))
+	assert.Equal(t, int64(500), failed[tracing.AttrHTTPStatusCode].AsInt64())
+	assert.True(t, failed[tracing.AttrHTTPError].AsBool())
+	assert.Equal(t, "http_error", failed[tracing.AttrErrorType].AsString())
+	assert.Equal(t, "HTTP 500", failed[tracing.AttrErrorMessage].AsString())
+}
+
+func TestGetUsersChangedSince(t *testing.T) {
+	router := setupTestRouter()
+
+	createUser := func(req models.CreateUserRequest) {
+		jsonData, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+		httpReq.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, httpReq)
+		assert.Equal(t, 201, w.Code)
+	}
+	createUser(models.CreateUserRequest{FirstName: "Stale", LastName: "User", Email: "stale@example.com"})
+	createUser(models.CreateUserRequest{FirstName: "Edited", LastName: "User", Email: "edited@example.com"})
+
+	since := time.Now().UTC()
+
+	// Update one existing user and create another after the checkpoint
+	jsonData, _ := json.Marshal([]models.CreateUserRequest{
+		{FirstName: "Renamed", LastName: "User", Email: "edited@example.com"},
+		{FirstName: "Newer", LastName: "User", Email: "newer@example.com"},
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/users/bulk", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users?changed_since="+since.Format(time.RFC3339Nano), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	users := response["data"].([]interface{})
+	assert.Len(t, users, 2)
+	assert.Equal(t, "Renamed", users[0].(map[string]interface{})["first_name"])
+	assert.Equal(t, "newer@example.com", users[1].(map[string]interface{})["email"])
+	assert.Equal(t, float64(2), response["pagination"].(map[string]interface{})["total"])
+
+	// Invalid timestamps are rejected
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users?changed_since=yesterday", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+
+	// IDs-only listing has no change filter
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users?format=ids&changed_since="+since.Format(time.RFC3339), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestChangedSinceIncludesTombstones(t *testing.T) {
+	boltRepo, err := repository.NewBoltUserRepository(filepath.Join(t.TempDir(), "users.db"))
+	assert.NoError(t, err)
+	defer boltRepo.Close()
+
+	repos := map[string]repository.UserRepository{
+		"memory": repository.NewInMemoryUserRepository(),
+		"bolt":   boltRepo,
+	}
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			userService := services.NewUserService(repo)
+			ctx := context.Background()
+
+			seed := func(first, email string) *models.User {
+				user, err := userService.CreateUser(ctx, models.CreateUserRequest{FirstName: first, LastName: "User", Email: email})
+				assert.NoError(t, err)
+				return user
+			}
+			seed("Stale", "stale@example.com")
+			edited := seed("Edited", "edited@example.com")
+			removed := seed("Removed", "removed@example.com")
+
+			since := time.Now()
+			time.Sleep(time.Millisecond)
+
+			_, err := userService.UpdateUser(ctx, edited.ID, models.UpdateUserRequest{FirstName: "Renamed", LastName: "User", Email: "edited@example.com"})
+			assert.NoError(t, err)
+			assert.NoError(t, userService.DeleteUser(ctx, removed.ID))
+			seed("Newer", "newer@example.com")
+
+			delta, total, err := userService.ListUsersChangedSince(ctx, since, 1, 20)
+			assert.NoError(t, err)
+			assert.Equal(t, 3, total)
+			if !assert.Len(t, delta, 3) {
+				return
+			}
+
+			assert.Equal(t, "Renamed", delta[0].FirstName)
+			assert.Nil(t, delta[0].DeletedAt)
+
+			// The deletion is a tombstone carrying only the ID and timestamps
+			tombstone := delta[1]
+			assert.Equal(t, removed.ID, tombstone.ID)
+			if assert.NotNil(t, tombstone.DeletedAt) {
+				assert.True(t, tombstone.DeletedAt.Equal(tombstone.UpdatedAt))
+				assert.False(t, tombstone.DeletedAt.Before(since))
+			}
+			assert.Empty(t, tombstone.Email)
+			body, _ := json.Marshal(tombstone.ToResponse())
+			assert.Contains(t, string(body), `"deleted_at"`)
+
+			assert.Equal(t, "newer@example.com", delta[2].Email)
+
+			// Tombstones stay out of regular reads
+			_, total, err = userService.ListUsers(ctx, 1, 20)
+			assert.NoError(t, err)
+			assert.Equal(t, 3, total)
+			_, err = userService.GetUserByID(ctx, removed.ID)
+			assert.EqualError(t, err, "user not found")
+		})
+	}
+}
+
+func TestTombstoneRetention(t *testing.T) {
+	boltRepo, err := repository.NewBoltUserRepository(filepath.Join(t.TempDir(), "users.db"))
+	assert.NoError(t, err)
+	defer boltRepo.Close()
+
+	repos := map[string]interface {
+		repository.UserRepository
+		SetTombstoneRetention(time.Duration)
+	}{
+		"memory": repository.NewInMemoryUserRepository(),
+		"bolt":   boltRepo,
+	}
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			repo.SetTombstoneRetention(50 * time.Millisecond)
+			userService := services.NewUserService(repo)
+			ctx := context.Background()
+
+			first, err := userService.CreateUser(ctx, models.CreateUserRequest{FirstName: "First", LastName: "User", Email: "first@example.com"})
+			assert.NoError(t, err)
+			second, err := userService.CreateUser(ctx, models.CreateUserRequest{FirstName: "Second", LastName: "User", Email: "second@example.com"})
+			assert.NoError(t, err)
+
+			assert.NoError(t, userService.DeleteUser(ctx, first.ID))
+			time.Sleep(60 * time.Millisecond)
+			assert.NoError(t, userService.DeleteUser(ctx, second.ID))
+
+			// The first tombstone outlived the retention window and is gone
+			delta, _, err := userService.ListUsersChangedSince(ctx, time.Time{}, 1, 20)
+			assert.NoError(t, err)
+			if assert.Len(t, delta, 1) {
+				assert.Equal(t, second.ID, delta[0].ID)
+			}
+
+			// Expired tombstones are left out of reads even before the next delete prunes them
+			time.Sleep(60 * time.Millisecond)
+			delta, _, err = userService.ListUsersChangedSince(ctx, time.Time{}, 1, 20)
+			assert.NoError(t, err)
+			assert.Empty(t, delta)
+		})
+	}
+}
+
+func TestRecoveryPanicDetails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, exposeDetails := range []bool{true, false} {
+		router := gin.New()
+		router.Use(middleware.Recovery(exposeDetails))
+		router.GET("/panic", func(c *gin.Context) {
+			panic("repository exploded")
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/panic", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 500, w.Code)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, "Internal server error", response["message"])
+		if exposeDetails {
+			assert.Equal(t, "repository exploded", response["panic"])
+			assert.Contains(t, response["stack"], "goroutine")
+		} else {
+			assert.NotContains(t, response, "panic")
+			assert.NotContains(t, response, "stack")
+			assert.NotContains(t, w.Body.String(), "repository exploded")
+		}
+	}
+}
+
+func TestPanicDetailsNeverInProduction(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "production")
+	t.Setenv("PANIC_DETAILS", "true")
+	assert.False(t, loadConfig(t).PanicDetails)
+
+	t.Setenv("ENVIRONMENT", "development")
+	t.Setenv("PANIC_DETAILS", "")
+	assert.True(t, loadConfig(t).PanicDetails)
+}
+
+func TestBaggageSampler(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(tracing.NewBaggageSampler(sdktrace.NeverSample())),
+		sdktrace.WithSpanProcessor(recorder),
+	)
+	defer tp.Shutdown(context.Background())
+	tracer := tp.Tracer("baggage-test")
+
+	// Without the baggage member the 0.0 base rate drops the span
+	_, span := tracer.Start(context.Background(), "unsampled")
+	span.End()
+	assert.Empty(t, recorder.Ended())
+
+	// A positive sampling.priority forces the span to be recorded
+	member, err := baggage.NewMember(tracing.SamplingPriorityBaggageKey, "1")
+	assert.NoError(t, err)
+	bag, err := baggage.New(member)
+	assert.NoError(t, err)
+	ctx := baggage.ContextWithBaggage(context.Background(), bag)
+
+	_, span = tracer.Start(ctx, "debug-flow")
+	assert.True(t, span.SpanContext().IsSampled())
+	span.End()
+	assert.NotNil(t, findSpan(recorder, "debug-flow"))
+
+	// The flag is off unless set, and invalid values are logged rather than silently ignored
+	t.Setenv("TRACING_BAGGAGE_SAMPLING", "true")
+	assert.True(t, tracing.LoadTracingConfigFromEnv("production").BaggageSampling)
+
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+	t.Setenv("TRACING_BAGGAGE_SAMPLING", "enabled")
+	assert.False(t, tracing.LoadTracingConfigFromEnv("production").BaggageSampling)
+	assert.Contains(t, logBuf.String(), `Invalid value for TRACING_BAGGAGE_SAMPLING: "enabled", using default false`)
+}
+
+// slowUserRepository delays reads until the delay passes or the context ends
+type slowUserRepository struct {
+	*repository.InMemoryUserRepository
+	delay time.Duration
+}
+
+func (r *slowUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	select {
+	case <-time.After(r.delay):
+		return r.InMemoryUserRepository.GetByID(ctx, id)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestRepositoryDeadline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := &slowUserRepository{InMemoryUserRepository: repository.NewInMemoryUserRepository(), delay: 200 * time.Millisecond}
+	userService, err := services.NewUserServiceWithConfig(repo, services.UserServiceConfig{
+		RepositoryTimeout: 20 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	// A slow repository call is cut off and mapped to 504
+	router := gin.New()
+	router.GET("/api/users/:id", handlers.NewUserHandler(userService).GetUser)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/users/some-id", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 504, w.Code)
+
+	// A share of the request budget applies when it is tighter than the fixed timeout
+	userService, err = services.NewUserServiceWithConfig(repo, services.UserServiceConfig{
+		RepositoryTimeout:        time.Second,
+		RepositoryBudgetFraction: 0.1,
+	})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = userService.GetUserByID(ctx, "some-id")
+	assert.ErrorIs(t, err, services.ErrRepositoryTimeout)
+	assert.Less(t, time.Since(start), 150*time.Millisecond)
+
+	// Fast calls are unaffected
+	repo.delay = 0
+	_, err = userService.GetUserByID(context.Background(), "some-id")
+	assert.NotErrorIs(t, err, services.ErrRepositoryTimeout)
+	assert.Contains(t, err.Error(), "not found")
+}
+
+func TestNullOptionals(t *testing.T) {
+	user := models.NewUser(models.CreateUserRequest{FirstName: "Null", LastName: "User", Email: "null@example.com", Locale: "th-TH"})
+
+	// Empty optional fields are omitted by default
+	data, err := json.Marshal(user.ToResponse())
+	assert.NoError(t, err)
+	var response map[string]interface{}
+	json.Unmarshal(data, &response)
+	assert.NotContains(t, response, "phone")
+	assert.NotContains(t, response, "address")
+	assert.Equal(t, "th-TH", response["locale"])
+
+	// With NULL_OPTIONALS they are written as null and set values are kept
+	models.SetNullOptionals(true)
+	defer models.SetNullOptionals(false)
+
+	data, err = json.Marshal(user.ToResponse())
+	assert.NoError(t, err)
+	response = map[string]interface{}{}
+	json.Unmarshal(data, &response)
+	for _, field := range []string{"phone", "date_of_birth", "address"} {
+		value, ok := response[field]
+		assert.True(t, ok, field)
+		assert.Nil(t, value, field)
+	}
+	assert.Equal(t, "th-TH", response["locale"])
+	assert.Equal(t, "null@example.com", response["email"])
+	assert.NotContains(t, response, "transformations")
+}
+
+func TestJSONContentType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name          string
+		contentType   string
+		allowSubtypes bool
+		wantStatus    int
+	}{
+		{name: "plain", contentType: "application/json", wantStatus: 200},
+		{name: "charset parameter", contentType: "application/json; charset=utf-8", wantStatus: 200},
+		{name: "vendor subtype disallowed", contentType: "application/vnd.example+json", wantStatus: 400},
+		{name: "vendor subtype allowed", contentType: "application/vnd.example+json", allowSubtypes: true, wantStatus: 200},
+		{name: "wrong type", contentType: "text/plain", allowSubtypes: true, wantStatus: 400},
+		{name: "malformed", contentType: "application/json; charset", wantStatus: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(middleware.JSONContentType(tt.allowSubtypes))
+			router.POST("/items", func(c *gin.Context) {
+				c.Status(200)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/items", bytes.NewBufferString("{}"))
+			req.Header.Set("Content-Type", tt.contentType)
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestOTLPTransportSecurity(t *testing.T) {
+	exportTo := func(t *testing.T, server *httptest.Server, config tracing.TracingConfig) {
+		config.Enabled = true
+		config.ExporterTypes = []string{"otlp"}
+		config.SamplingRate = 1.0
+		config.OTLPEndpoint = server.URL + "/v1/traces"
+
+		shutdown, err := tracing.InitTracing(config)
+		assert.NoError(t, err)
+		_, span := otel.Tracer("otlp-test").Start(context.Background(), "exported")
+		span.End()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		assert.NoError(t, shutdown(ctx))
+	}
+
+	var received atomic.Int64
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/traces" {
+			received.Add(1)
+		}
+		w.WriteHeader(200)
+	})
+
+	// Insecure mode speaks plain HTTP to the collector
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	exportTo(t, plain, tracing.TracingConfig{OTLPInsecure: true})
+	assert.Equal(t, int64(1), received.Load())
+
+	// Secure mode uses TLS, trusting the configured CA
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: secure.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(caPath, caPEM, 0o600))
+	exportTo(t, secure, tracing.TracingConfig{OTLPCACertPath: caPath})
+	assert.Equal(t, int64(2), received.Load())
+
+	// An unreadable CA file fails initialization
+	_, err := tracing.InitTracing(tracing.TracingConfig{
+		Enabled:        true,
+		ExporterTypes:  []string{"otlp"},
+		OTLPCACertPath: filepath.Join(t.TempDir(), "missing.pem"),
+	})
+	assert.Error(t, err)
+
+	// A scheme that contradicts the transport setting fails initialization
+	_, err = tracing.InitTracing(tracing.TracingConfig{
+		Enabled:       true,
+		ExporterTypes: []string{"otlp"},
+		OTLPEndpoint:  "http://collector:4318/v1/traces",
+	})
+	assert.ErrorContains(t, err, "uses http but insecure transport is disabled")
+	_, err = tracing.InitTracing(tracing.TracingConfig{
+		Enabled:       true,
+		ExporterTypes: []string{"otlp"},
+		OTLPEndpoint:  "https://collector:4318/v1/traces",
+		OTLPInsecure:  true,
+	})
+	assert.ErrorContains(t, err, "uses https but insecure transport is enabled")
+
+	// Without TRACING_OTLP_INSECURE the transport follows the endpoint scheme outside production
+	t.Setenv("TRACING_OTLP_INSECURE", "")
+	t.Setenv("TRACING_OTLP_ENDPOINT", "")
+	assert.True(t, tracing.LoadTracingConfigFromEnv("staging").OTLPInsecure)
+	t.Setenv("TRACING_OTLP_ENDPOINT", "https://collector:4318/v1/traces")
+	assert.False(t, tracing.LoadTracingConfigFromEnv("development").OTLPInsecure)
+	t.Setenv("TRACING_OTLP_ENDPOINT", "collector:4318")
+	assert.False(t, tracing.LoadTracingConfigFromEnv("production").OTLPInsecure)
+
+	// Production defaults to TLS even for the http default endpoint, so plaintext must be opted into
+	t.Setenv("TRACING_OTLP_ENDPOINT", "")
+	production := tracing.LoadTracingConfigFromEnv("production")
+	assert.False(t, production.OTLPInsecure)
+	production.Enabled = true
+	production.ExporterTypes = []string{"otlp"}
+	_, err = tracing.InitTracing(production)
+	assert.ErrorContains(t, err, "set TRACING_OTLP_INSECURE=true")
+	t.Setenv("TRACING_OTLP_INSECURE", "true")
+	assert.True(t, tracing.LoadTracingConfigFromEnv("production").OTLPInsecure)
+
+	// Invalid values are logged and keep the default
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+	t.Setenv("TRACING_OTLP_INSECURE", "yes please")
+	assert.False(t, tracing.LoadTracingConfigFromEnv("production").OTLPInsecure)
+	assert.Contains(t, logBuf.String(), `Invalid value for TRACING_OTLP_INSECURE: "yes please", using default false`)
+}
+
+func TestRequestLifecycleEvents(t *testing.T) {
+	recorder := setupSpanRecorder(t)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.TracingMiddleware(tracing.ServiceName, "/health"))
+	router.Use(middleware.EnhancedTracingMiddleware())
+	router.GET("/ping", func(c *gin.Context) { c.Status(204) })
+	router.GET("/health", func(c *gin.Context) { c.Status(200) })
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ping", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 204, w.Code)
+
+	span := findSpan(recorder, "/ping")
+	assert.NotNil(t, span)
+	events := make(map[string]map[attribute.Key]attribute.Value)
+	for _, event := range span.Events() {
+		attrs := make(map[attribute.Key]attribute.Value)
+		for _, attr := range event.Attributes {
+			attrs[attr.Key] = attr.Value
+		}
+		events[event.Name] = attrs
+	}
+	assert.Equal(t, "GET", events["request.received"][tracing.AttrHTTPMethod].AsString())
+	assert.Equal(t, "/ping", events["request.received"]["http.path"].AsString())
+	assert.Equal(t, int64(204), events["request.completed"][tracing.AttrHTTPStatusCode].AsInt64())
+	assert.Contains(t, events["request.completed"], attribute.Key("duration_ms"))
+
+	// Ignored paths produce no span at all
+	ended := len(recorder.Ended())
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/health", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Len(t, recorder.Ended(), ended)
+}
+
+func TestNameFormat(t *testing.T) {
+	user := models.NewUser(models.CreateUserRequest{FirstName: "Somchai", LastName: "Jaidee", Email: "somchai@example.com"})
+
+	tests := []struct {
+		format    string
+		separator string
+		want      string
+	}{
+		{format: models.NameFormatFirstLast, separator: " ", want: "Somchai Jaidee"},
+		{format: models.NameFormatLastFirst, separator: " ", want: "Jaidee Somchai"},
+		{format: models.NameFormatLastFirst, separator: ", ", want: "Jaidee, Somchai"},
+	}
+	for _, tt := range tests {
+		assert.NoError(t, models.SetNameFormat(tt.format, tt.separator))
+		assert.Equal(t, tt.want, user.ToResponse().FullName)
+	}
+	assert.NoError(t, models.SetNameFormat(models.NameFormatFirstLast, " "))
+	assert.Error(t, models.SetNameFormat("middle_first", " "))
+
+	// The query parameter overrides the configured format per request
+	router := setupTestRouter()
+	jsonData, _ := json.Marshal(models.CreateUserRequest{FirstName: "Somchai", LastName: "Jaidee", Email: "somchai@example.com"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 201, w.Code)
+
+	var created map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	id := created["data"].(map[string]interface{})["id"].(string)
+	assert.Equal(t, "Somchai Jaidee", created["data"].(map[string]interface{})["full_name"])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users/"+id+"?name_format=last_first", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "Jaidee Somchai", response["data"].(map[string]interface{})["full_name"])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users?name_format=last_first", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "Jaidee Somchai", response["data"].([]interface{})[0].(map[string]interface{})["full_name"])
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/users/"+id+"?name_format=sideways", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestRepositoryIntegrity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repo := repository.NewInMemoryUserRepository()
+	userService := services.NewUserService(repo)
+	userHandler := handlers.NewUserHandler(userService)
+	router := gin.New()
+	router.GET("/admin/integrity", userHandler.VerifyIntegrity)
+	router.POST("/admin/integrity/repair", userHandler.VerifyIntegrity)
+
+	check := func(method, path string) map[string]interface{} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 200, w.Code)
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response["data"].(map[string]interface{})
+	}
+
+	ctx := context.Background()
+	first, err := userService.CreateUser(ctx, models.CreateUserRequest{FirstName: "First", LastName: "User", Email: "first@example.com"})
+	assert.NoError(t, err)
+	second, err := userService.CreateUser(ctx, models.CreateUserRequest{FirstName: "Second", LastName: "User", Email: "second@example.com"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, true, check("GET", "/admin/integrity")["consistent"])
+
+	// Corrupt the index through the shared pointers: a changed ID and a duplicated email
+	originalID := first.ID
+	first.ID = "replayed-id"
+	second.Email = "first@example.com"
+
+	report := check("GET", "/admin/integrity")
+	assert.Equal(t, false, report["consistent"])
+	assert.Len(t, report["problems"], 2)
+	assert.Contains(t, fmt.Sprint(report["problems"]), `user "replayed-id" is indexed under "`+originalID+`"`)
+	assert.Contains(t, fmt.Sprint(report["problems"]), `email "first@example.com" is shared`)
+
+	// Repair re-indexes the user; the duplicate email is left for a human
+	report = check("POST", "/admin/integrity/repair")
+	assert.Equal(t, true, report["repaired"])
+	assert.Len(t, report["problems"], 1)
+	assert.Contains(t, fmt.Sprint(report["problems"]), "shared")
+
+	user, err := repo.GetByID(ctx, "replayed-id")
+	assert.NoError(t, err)
+	assert.Equal(t, "First", user.FirstName)
+
+	// Emails differing only in case are distinct, as they are for Create and Update
+	second.Email = "First@example.com"
+	problems, err := repo.VerifyIntegrity(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+
+	// Users sharing an ID are reported and both kept, never overwritten by a repair
+	third, err := userService.CreateUser(ctx, models.CreateUserRequest{FirstName: "Third", LastName: "User", Email: "third@example.com"})
+	assert.NoError(t, err)
+	thirdKey := third.ID
+	third.ID = second.ID
+	for _, repair := range []bool{false, true} {
+		if repair {
+			problems, err = repo.RepairIntegrity(ctx)
+		} else {
+			problems, err = repo.VerifyIntegrity(ctx)
+		}
+		assert.NoError(t, err)
+		assert.Contains(t, fmt.Sprint(problems), fmt.Sprintf("ID %q is shared", second.ID))
+		assert.Contains(t, fmt.Sprint(problems), thirdKey)
+	}
+	users, err := repo.GetAll(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, users, 3)
+	names := make([]string, 0, len(users))
+	for _, user := range users {
+		names = append(names, user.FirstName)
+	}
+	assert.ElementsMatch(t, []string{"First", "Second", "Third"}, names)
+}
+
+func TestBoltRepositoryIntegrity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.db")
+	repo, err := repository.NewBoltUserRepository(path)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	first := models.NewUser(models.CreateUserRequest{FirstName: "First", LastName: "User", Email: "first@example.com"})
+	second := models.NewUser(models.CreateUserRequest{FirstName: "Second", LastName: "User", Email: "second@example.com"})
+	assert.NoError(t, repo.Create(ctx, first))
+	assert.NoError(t, repo.Create(ctx, second))
+
+	var checker repository.IntegrityChecker = repo
+	problems, err := checker.VerifyIntegrity(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+	assert.NoError(t, repo.Close())
+
+	// Corrupt the email index behind the repository's back
+	db, err := bolt.Open(path, 0600, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		emails := tx.Bucket([]byte("emails"))
+		if err := emails.Delete([]byte("first@example.com")); err != nil {
+			return err
+		}
+		return emails.Put([]byte("ghost@example.com"), []byte(second.ID))
+	}))
+	assert.NoError(t, db.Close())
+
+	repo, err = repository.NewBoltUserRepository(path)
+	assert.NoError(t, err)
+	defer repo.Close()
+
+	problems, err = repo.VerifyIntegrity(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, problems, 2)
+	assert.Contains(t, fmt.Sprint(problems), `email "first@example.com" of user "`+first.ID+`" is not indexed`)
+	assert.Contains(t, fmt.Sprint(problems), `email index entry "ghost@example.com" points to user "`+second.ID+`"`)
+	_, err = repo.GetByEmail(ctx, "first@example.com")
+	assert.EqualError(t, err, "user not found")
+
+	// Repair rebuilds the index from the users
+	problems, err = repo.RepairIntegrity(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+	user, err := repo.GetByEmail(ctx, "first@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, first.ID, user.ID)
+	_, err = repo.GetByEmail(ctx, "ghost@example.com")
+	assert.EqualError(t, err, "user not found")
+	page, total, err := repo.ListPage(ctx, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Len(t, page, 2)
+}
+
+func TestAcceptCamelCase(t *testing.T) {
+	router := setupTestRouter()
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/users", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	camelBody := `{"firstName":"Camel","lastName":"Case","email":"camel@example.com","dateOfBirth":"1990-01-02","address":{"city":"Bangkok","postalCode":"10110"}}`
+
+	// Disabled by default: camelCase keys are unknown, so required fields are missing
+	assert.Equal(t, 400, post(camelBody).Code)
+
+	models.SetAcceptCamelCase(true)
+	defer models.SetAcceptCamelCase(false)
+
+	w := post(camelBody)
+	assert.Equal(t, 201, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(t, "Camel", data["first_name"])
+	assert.Equal(t, "1990-01-02", data["date_of_birth"])
+	assert.Equal(t, "10110", data["address"].(map[string]interface{})["postal_code"])
+	assert.NotContains(t, data, "firstName")
+
+	// snake_case keeps working alongside
+	assert.Equal(t, 201, post(`{"first_name":"Snake","last_name":"Case","email":"snake@example.com"}`).Code)
+
+	// Both spellings of one field are ambiguous
+	w = post(`{"firstName":"Both","first_name":"Both","last_name":"Case","email":"both@example.com"}`)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "firstName")
+}
+
+func TestValidationFailureReasons(t *testing.T) {
+	recorder := setupSpanRecorder(t)
+
+	userService := services.NewUserService(repository.NewInMemoryUserRepository())
+	_, err := userService.CreateUser(context.Background(), models.CreateUserRequest{
+		LastName: "User",
+		Email:    "not-an-email",
+	})
+	assert.Error(t, err)
+
+	span := findSpan(recorder, "UserService.CreateUser")
+	assert.NotNil(t, span)
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, attr := range span.Attributes() {
+		attrs[attr.Key] = attr.Value
+	}
+	assert.Equal(t, []string{"email", "required"}, attrs["validation.failed_tags"].AsStringSlice())
+	assert.Equal(t, []string{"email:email", "first_name:required"}, attrs["validation.failed_fields"].AsStringSlice())
+
+	assert.Equal(t, map[string]int64{"email:email": 1, "first_name:required": 1}, userService.ValidationFailureCounts())
+
+	// Failure counts are reported with the debug stats
+	router := gin.New()
+	router.GET("/debug/stats", handlers.NewUserHandler(userService).DebugStats)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/stats", nil)
+	router.ServeHTTP(w, req)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(t, "memory", data["backend"])
+	assert.Equal(t, float64(1), data["validation_failures"].(map[string]interface{})["first_name:required"])
+}
+
+func TestBatchValidationFailureEvents(t *testing.T) {
+	recorder := setupSpanRecorder(t)
+
+	userService := services.NewUserService(repository.NewInMemoryUserRepository())
+	_, err := userService.ValidateUsers(context.Background(), []models.CreateUserRequest{
+		{LastName: "User", Email: "missing-first@example.com"},
+		{FirstName: "Valid", LastName: "User", Email: "valid@example.com"},
+		{FirstName: "Bad", LastName: "Email", Email: "not-an-email"},
+	})
+	assert.NoError(t, err)
+
+	span := findSpan(recorder, "UserService.ValidateUsers")
+	if !assert.NotNil(t, span) {
+		return
+	}
+
+	// Each failed item keeps its own reasons instead of the last one winning
+	failures := make(map[int64][]string)
+	for _, event := range span.Events() {
+		if event.Name != "validation.failed" {
+			continue
+		}
+		attrs := make(map[attribute.Key]attribute.Value)
+		for _, attr := range event.Attributes {
+			attrs[attr.Key] = attr.Value
+		}
+		failures[attrs["batch.index"].AsInt64()] = attrs["validation.failed_fields"].AsStringSlice()
+	}
+	assert.Equal(t, map[int64][]string{
+		0: {"first_name:required"},
+		2: {"email:email"},
+	}, failures)
+	for _, attr := range span.Attributes() {
+		assert.NotEqual(t, attribute.Key("validation.failed_fields"), attr.Key)
+	}
+}
+
+func TestGetOrCreateConcurrent(t *testing.T) {
+	repo := repository.NewInMemoryUserRepository()
+	userService := services.NewUserService(repo)
+
+	const callers = 8
+	var created atomic.Int64
+	ids := make([]string, callers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			user, isNew, err := userService.GetOrCreate(context.Background(), models.CreateUserRequest{
+				FirstName: "Racing",
+				LastName:  "User",
+				Email:     "racing@example.com",
+			})
+			assert.NoError(t, err)
+			if isNew {
+				created.Add(1)
+			}
+			ids[i] = user.ID
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, int64(1), created.Load())
+	for _, id := range ids {
+		assert.Equal(t, ids[0], id)
+	}
+	users, err := repo.GetAll(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+}
+
+func TestCreateUserRaceSameEmail(t *testing.T) {
+	router := setupTestRouter()
+	jsonData, _ := json.Marshal(models.CreateUserRequest{FirstName: "Race", LastName: "User", Email: "race@example.com"})
+
+	const callers = 8
+	codes := make([]int, callers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/api/users", bytes.NewBuffer(jsonData))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			codes[i] = w.Code
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	created, conflicts := 0, 0
+	for _, code := range codes {
+		switch code {
+		case 201:
+			created++
+		case 409:
+			conflicts++
+		}
+	}
+	assert.Equal(t, 1, created)
+	assert.Equal(t, callers-1, conflicts)
+
+	// The repository itself rejects a duplicate that slipped past the service check
+	repo := repository.NewInMemoryUserRepository()
+	assert.NoError(t, repo.Create(context.Background(), models.NewUser(models.CreateUserRequest{Email: "dup@example.com"})))
+	err := repo.Create(context.Background(), models.NewUser(models.CreateUserRequest{Email: "dup@example.com"}))
+	assert.ErrorIs(t, err, repository.ErrDuplicateEmail)
+}
+
+func TestStreamUserEvents(t *testing.T) {
+	server := httptest.NewServer(setupTestRouter())
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/users/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// The subscription is live once headers arrive
+	jsonData, _ := json.Marshal(models.CreateUserRequest{FirstName: "Event", LastName: "User", Email: "event@example.com"})
+	created, err := http.Post(server.URL+"/api/users", "application/json", bytes.NewBuffer(jsonData))
+	assert.NoError(t, err)
+	created.Body.Close()
+	assert.Equal(t, 201, created.StatusCode)
+
+	scanner := bufio.NewScanner(resp.Body)
+	var frame []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" && len(frame) > 0 {
+			break
+		}
+		frame = append(frame, line)
+	}
+	assert.Equal(t, "event:created", frame[0])
+	assert.True(t, strings.HasPrefix(frame[1], "data:"))
+
+	var event models.UserEvent
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(frame[1], "data:")), &event))
+	assert.Equal(t, models.UserEventCreated, event.Type)
+	assert.Equal(t, "event@example.com", event.User.Email)
+}
+
+func TestStreamUserEventsDeleted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userService := services.NewUserService(repository.NewInMemoryUserRepository())
+	router := gin.New()
+	router.GET("/api/users/events", handlers.NewUserHandler(userService).StreamUserEvents)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/users/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	user, err := userService.CreateUser(ctx, models.CreateUserRequest{FirstName: "Gone", LastName: "User", Email: "gone@example.com"})
+	assert.NoError(t, err)
+	assert.NoError(t, userService.DeleteUser(ctx, user.ID))
+
+	var names []string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(names) < 2 && scanner.Scan() {
+		if name, ok := strings.CutPrefix(scanner.Text(), "event:"); ok {
+			names = append(names, name)
+		}
+	}
+	assert.Equal(t, []string{models.UserEventCreated, models.UserEventDeleted}, names)
+}
+
+func TestUserEventsWebSocket(t *testing.T) {
+	server := httptest.NewServer(setupTestRouter())
+	defer server.Close()
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/users/ws", nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	// The handler subscribes before completing the handshake, so the stream is live now
+	jsonData, _ := json.Marshal(models.CreateUserRequest{FirstName: "Socket", LastName: "User", Email: "socket@example.com"})
+	created, err := http.Post(server.URL+"/api/users", "application/json", bytes.NewBuffer(jsonData))
+	assert.NoError(t, err)
+	created.Body.Close()
+	assert.Equal(t, 201, created.StatusCode)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var event models.UserEvent
+	assert.NoError(t, conn.ReadJSON(&event))
+	assert.Equal(t, models.UserEventCreated, event.Type)
+	assert.Equal(t, "socket@example.com", event.User.Email)
+}
+
+func TestUpdateUser(t *testing.T) {
+	router := setupTestRouter()
+	send := func(method, path string, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+		jsonData, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response
+	}
+
+	w, created := send("POST", "/api/users", models.CreateUserRequest{FirstName: "Before", LastName: "Update", Email: "before@example.com"})
+	assert.Equal(t, 201, w.Code)
+	original := created["data"].(map[string]interface{})
+	id := original["id"].(string)
+	w, _ = send("POST", "/api/users", models.CreateUserRequest{FirstName: "Other", LastName: "User", Email: "other@example.com"})
+	assert.Equal(t, 201, w.Code)
+
+	time.Sleep(10 * time.Millisecond)
+
+	// Fields are replaced, UpdatedAt moves and CreatedAt stays
+	w, updated := send("PUT", "/api/users/"+id, models.UpdateUserRequest{FirstName: "After", LastName: "Update", Email: "after@example.com", Phone: "0812345678"})
+	assert.Equal(t, 200, w.Code)
+	data := updated["data"].(map[string]interface{})
+	assert.Equal(t, id, data["id"])
+	assert.Equal(t, "After", data["first_name"])
+	assert.Equal(t, "after@example.com", data["email"])
+	assert.Equal(t, original["created_at"], data["created_at"])
+	createdAt, _ := time.Parse(time.RFC3339Nano, original["updated_at"].(string))
+	updatedAt, _ := time.Parse(time.RFC3339Nano, data["updated_at"].(string))
+	assert.True(t, updatedAt.After(createdAt))
+
+	w, fetched := send("GET", "/api/users/"+id, nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "After", fetched["data"].(map[string]interface{})["first_name"])
+
+	// Unknown ID
+	w, _ = send("PUT", "/api/users/missing-id", models.UpdateUserRequest{FirstName: "Nobody", LastName: "Here", Email: "nobody@example.com"})
+	assert.Equal(t, 404, w.Code)
+
+	// Email held by a different user
+	w, _ = send("PUT", "/api/users/"+id, models.UpdateUserRequest{FirstName: "After", LastName: "Update", Email: "other@example.com"})
+	assert.Equal(t, 409, w.Code)
+
+	// Keeping the user's own email is not a conflict
+	w, _ = send("PUT", "/api/users/"+id, models.UpdateUserRequest{FirstName: "Again", LastName: "Update", Email: "after@example.com"})
+	assert.Equal(t, 200, w.Code)
+
+	// Validation failure
+	w, _ = send("PUT", "/api/users/"+id, models.UpdateUserRequest{FirstName: "A", LastName: "Update", Email: "not-an-email"})
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestNewListenerLimitsConnections(t *testing.T) {
+	listener, err := newListener("127.0.0.1:0", 1)
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	first, err := net.Dial("tcp", listener.Addr().String())
+	assert.NoError(t, err)
+	defer first.Close()
+	second, err := net.Dial("tcp", listener.Addr().String())
+	assert.NoError(t, err)
+	defer second.Close()
+
+	// Only one connection is handed out while the first stays open
+	firstServer := <-accepted
+	select {
+	case <-accepted:
+		t.Fatal("second connection accepted beyond the limit")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Closing the first frees the slot for the second
+	firstServer.Close()
+	select {
+	case conn := <-accepted:
+		conn.Close()
+	case <-time.After(2 * time.Second):
+		t.Fatal("second connection was never accepted")
+	}
+
+	// Zero leaves the listener unlimited
+	unlimited, err := newListener("127.0.0.1:0", 0)
+	assert.NoError(t, err)
+	defer unlimited.Close()
+	_, isTCP := unlimited.(*net.TCPListener)
+	assert.True(t, isTCP)
+}
+
+func TestWarmListCache(t *testing.T) {
+	recorder := setupSpanRecorder(t)
+
+	userRepo := repository.NewInMemoryUserRepository()
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		userRepo.Create(ctx, models.NewUser(models.CreateUserRequest{
+			FirstName: "Warm",
+			LastName:  "User",
+			Email:     fmt.Sprintf("warm%d@example.com", i),
+		}))
+	}
+
+	userService, err := services.NewUserServiceWithConfig(userRepo, services.UserServiceConfig{
+		ListCacheTTL:         time.Minute,
+		ListCacheWarmPages:   10,
+		ListCacheWarmTimeout: time.Second,
+	})
+	assert.NoError(t, err)
+
+	// Warming stops at the last page
+	warmed, err := userService.WarmListCache(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, warmed)
+
+	// Warmed pages are served from the cache
+	users, total, err := userService.ListUsers(ctx, 2, 2)
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	assert.Equal(t, 5, total)
+
+	var hits []bool
+	for _, span := range recorder.Ended() {
+		if span.Name() != "UserService.ListUsers" {
+			continue
+		}
+		for _, attr := range span.Attributes() {
+			if attr.Key == "cache.hit" {
+				hits = append(hits, attr.Value.AsBool())
+			}
+		}
+	}
+	assert.Equal(t, []bool{false, false, false, true}, hits)
+	assert.NotNil(t, findSpan(recorder, "UserService.WarmListCache"))
+
+	// Warming is a no-op when the list cache is disabled
+	uncached, err := services.NewUserServiceWithConfig(userRepo, services.UserServiceConfig{ListCacheWarmPages: 10})
+	assert.NoError(t, err)
+	warmed, err = uncached.WarmListCache(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, warmed)
+}
+
+func TestMinimumAgeByCountry(t *testing.T) {
+	// A 14-year-old meets the US minimum but not the German one
+	dob := time.Now().AddDate(-14, 0, -1).Format("2006-01-02")
+
+	tests := []struct {
+		name    string
+		country string
+		dob     string
+		wantErr string
+	}{
+		{name: "US minimum met", country: "US", dob: dob},
+		{name: "DE minimum not met", country: "DE", dob: dob, wantErr: "DateOfBirth must show an age of at least 16 years"},
+		{name: "country matched case-insensitively", country: "de", dob: dob, wantErr: "DateOfBirth must show an age of at least 16 years"},
+		{name: "global default applies elsewhere", country: "TH", dob: dob, wantErr: "DateOfBirth must show an age of at least 18 years"},
+		{name: "global default without address", dob: dob, wantErr: "DateOfBirth must show an age of at least 18 years"},
+		{name: "no date of birth", country: "DE"},
+	}
+
+	userService, err := services.NewUserServiceWithConfig(repository.NewInMemoryUserRepository(), services.UserServiceConfig{
+		MinimumAge:          18,
+		MinimumAgeByCountry: map[string]int{"US": 13, "DE": 16},
+	})
+	assert.NoError(t, err)
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := models.CreateUserRequest{
+				FirstName:   "Age",
+				LastName:    "Check",
+				Email:       fmt.Sprintf("age%d@example.com", i),
+				DateOfBirth: tt.dob,
+			}
+			if tt.country != "" {
+				req.Address = &models.Address{Country: tt.country}
+			}
+
+			_, err := userService.CreateUser(context.Background(), req)
+			if tt.wantErr != "" {
+				var validationErr *services.ValidationError
+				assert.ErrorAs(t, err, &validationErr)
+				assert.Equal(t, tt.wantErr, err.Error())
+				assert.Equal(t, "date_of_birth", validationErr.Fields[0].Field)
+				assert.Equal(t, "min_age", validationErr.Fields[0].Tag)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestParseMinimumAges(t *testing.T) {
+	ages, err := services.ParseMinimumAges(" us=13, DE = 16 ,")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"US": 13, "DE": 16}, ages)
+
+	_, err = services.ParseMinimumAges("US")
+	assert.Error(t, err)
+	_, err = services.ParseMinimumAges("US=-1")
+	assert.Error(t, err)
+}
+
+func TestMinimumAgeConfigFailsFast(t *testing.T) {
+	t.Setenv("MINIMUM_AGE", "13")
+	t.Setenv("MINIMUM_AGE_BY_COUNTRY", "US=13")
+	cfg := loadUserServiceConfig(t)
+	assert.Equal(t, 13, cfg.MinimumAge)
+	assert.Equal(t, map[string]int{"US": 13}, cfg.MinimumAgeByCountry)
+
+	// Invalid ages are returned to the caller rather than disabling the check
+	for key, value := range map[string]string{"MINIMUM_AGE": "thirteen", "MINIMUM_AGE_BY_COUNTRY": "US"} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			_, err := services.LoadUserServiceConfigFromEnv()
+			assert.ErrorContains(t, err, key)
+			_, err = config.LoadConfig()
+			assert.ErrorContains(t, err, key)
+		})
+	}
+}
+
+func TestListParamsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var captured utils.ListParams
+	var found bool
+	router := gin.New()
+	router.GET("/list", middleware.ListParams(), func(c *gin.Context) {
+		captured, found = utils.GetListParams(c)
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/list?page=3&limit=5&changed_since=2024-01-02T15:04:05Z", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.True(t, found)
+	assert.Equal(t, 3, captured.Page)
+	assert.Equal(t, 5, captured.Limit)
+	assert.Equal(t, utils.ListFormatFull, captured.Format)
+	assert.Equal(t, time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), captured.ChangedSince)
+
+	// Defaults apply when parameters are absent
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/list?format=ids", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, utils.ListParams{Page: utils.DefaultPage, Limit: utils.DefaultLimit, Format: utils.ListFormatIDs}, captured)
+
+	invalid := []string{
+		"page=0",
+		"limit=abc",
+		"limit=1000",
+		"format=csv",
+		"changed_since=yesterday",
+		"changed_since=2024-01-02T15:04:05Z&format=ids",
+	}
+	for _, query := range invalid {
+		found = false
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/list?"+query, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		assert.False(t, found, "handler ran for %s", query)
+	}
+}
+
+func TestShutdownServerDrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte("done"))
+		}),
+	}
+	listener, err := newListener("127.0.0.1:0", 0)
+	assert.NoError(t, err)
+	go server.Serve(listener)
+
+	type result struct {
+		body string
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		results <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	assert.NoError(t, shutdownServer(server, 5*time.Second))
+
+	// The request in flight when shutdown began still completes
+	res := <-results
+	assert.NoError(t, res.err)
+	assert.Equal(t, "done", res.body)
+
+	// New connections are refused once the server has stopped
+	_, err = net.Dial("tcp", listener.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestBoltUserRepository(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.db")
+	repo, err := repository.NewBoltUserRepository(path)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	user := models.NewUser(models.CreateUserRequest{FirstName: "Bolt", LastName: "User", Email: "bolt@example.com"})
+	assert.NoError(t, repo.Create(ctx, user))
+
+	// Duplicate emails are rejected
+	duplicate := models.NewUser(models.CreateUserRequest{FirstName: "Bolt", LastName: "Twin", Email: "bolt@example.com"})
+	assert.ErrorIs(t, repo.Create(ctx, duplicate), repository.ErrDuplicateEmail)
+
+	fetched, err := repo.GetByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "bolt@example.com", fetched.Email)
+	assert.True(t, user.CreatedAt.Equal(fetched.CreatedAt))
+
+	byEmail, err := repo.GetByEmail(ctx, "bolt@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, byEmail.ID)
+
+	// Updating the email moves the index entry
+	other := models.NewUser(models.CreateUserRequest{FirstName: "Other", LastName: "User", Email: "other@example.com"})
+	assert.NoError(t, repo.Create(ctx, other))
+	fetched.Email = "renamed@example.com"
+	assert.NoError(t, repo.Update(ctx, fetched))
+	_, err = repo.GetByEmail(ctx, "bolt@example.com")
+	assert.EqualError(t, err, "user not found")
+	fetched.Email = "other@example.com"
+	assert.ErrorIs(t, repo.Update(ctx, fetched), repository.ErrDuplicateEmail)
+	missing := models.NewUser(models.CreateUserRequest{FirstName: "Missing", LastName: "User", Email: "missing@example.com"})
+	assert.EqualError(t, repo.Update(ctx, missing), "user not found")
+
+	// Upsert and GetOrCreate resolve existing users by email
+	created, err := repo.Upsert(ctx, models.NewUser(models.CreateUserRequest{FirstName: "Upsert", LastName: "User", Email: "other@example.com"}))
+	assert.NoError(t, err)
+	assert.False(t, created)
+	existing, created, err := repo.GetOrCreate(ctx, models.NewUser(models.CreateUserRequest{FirstName: "Again", LastName: "User", Email: "other@example.com"}))
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, other.ID, existing.ID)
+	assert.Equal(t, "Upsert", existing.FirstName)
+
+	ids, err := repo.GetAllIDs(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{user.ID, other.ID}, ids)
+
+	// Delete frees the email for reuse
+	assert.NoError(t, repo.Delete(ctx, other.ID))
+	assert.EqualError(t, repo.Delete(ctx, other.ID), "user not found")
+	_, err = repo.GetByID(ctx, other.ID)
+	assert.EqualError(t, err, "user not found")
+	assert.NoError(t, repo.Create(ctx, models.NewUser(models.CreateUserRequest{FirstName: "Reuse", LastName: "User", Email: "other@example.com"})))
+
+	// Data survives closing and reopening the file
+	assert.NoError(t, repo.Close())
+	reopened, err := repository.NewBoltUserRepository(path)
+	assert.NoError(t, err)
+	defer reopened.Close()
+
+	persisted, err := reopened.GetByID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "renamed@example.com", persisted.Email)
+	users, err := reopened.GetAll(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+
+	// Pages come from the creation-time index, which survives reopening
+	page, total, err := reopened.ListPage(ctx, 1, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Len(t, page, 1)
+	assert.Equal(t, "Reuse", page[0].FirstName)
+	page, total, err = reopened.ListPage(ctx, 5, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Empty(t, page)
+
+	stats, err := reopened.Stats(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "bolt", stats.Backend)
+	assert.Equal(t, 2, stats.UserCount)
+	assert.NoError(t, reopened.Ping(ctx))
+}
+
+func TestServerTimeoutConfig(t *testing.T) {
+	t.Setenv("SERVER_READ_TIMEOUT", "10s")
+	t.Setenv("SERVER_WRITE_TIMEOUT", "")
+	t.Setenv("SERVER_IDLE_TIMEOUT", "forever")
+
+	cfg := loadConfig(t)
+	assert.Equal(t, 10*time.Second, cfg.ReadTimeout)
+	assert.Equal(t, 15*time.Second, cfg.WriteTimeout)
+	// Invalid durations fall back to the default
+	assert.Equal(t, 60*time.Second, cfg.IdleTimeout)
+}
+
+// countingGetAllRepository counts full loads, to check caps are enforced before them
+type countingGetAllRepository struct {
+	*repository.InMemoryUserRepository
+	getAllCalls int
+}
+
+func (r *countingGetAllRepository) GetAll(ctx context.Context) ([]*models.User, error) {
+	r.getAllCalls++
+	return r.InMemoryUserRepository.GetAll(ctx)
+}
+
+func TestGetAllUsersCap(t *testing.T) {
+	userRepo := &countingGetAllRepository{InMemoryUserRepository: repository.NewInMemoryUserRepository()}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		userRepo.Create(ctx, models.NewUser(models.CreateUserRequest{
+			FirstName: "Capped",
+			LastName:  "User",
+			Email:     fmt.Sprintf("capped%d@example.com", i),
+		}))
+	}
+
+	tests := []struct {
+		name    string
+		max     int
+		wantErr bool
+	}{
+		{name: "below cap", max: 5},
+		{name: "at cap", max: 3},
+		{name: "above cap", max: 2, wantErr: true},
+		{name: "cap disabled", max: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userService, err := services.NewUserServiceWithConfig(userRepo, services.UserServiceConfig{MaxGetAllUsers: tt.max})
+			assert.NoError(t, err)
+
+			userRepo.getAllCalls = 0
+			users, err := userService.GetAllUsers(ctx)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, services.ErrTooManyUsers)
+				assert.Contains(t, err.Error(), "paginate")
+				assert.Nil(t, users)
+				assert.Zero(t, userRepo.getAllCalls, "the cap is checked before loading users")
+
+				// The duplicate scan loads every user too, so the cap applies there as well
+				_, err = userService.FindDuplicates(ctx)
+				assert.ErrorIs(t, err, services.ErrDuplicateScanTooLarge)
+				assert.Contains(t, err.Error(), "MAX_GET_ALL_USERS")
+				assert.Zero(t, userRepo.getAllCalls)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, users, 3)
+		})
+	}
+
+	// The default applies when loading from the environment
+	t.Setenv("MAX_GET_ALL_USERS", "")
+	assert.Equal(t, services.DefaultMaxGetAllUsers, loadUserServiceConfig(t).MaxGetAllUsers)
+	t.Setenv("MAX_GET_ALL_USERS", "50")
+	assert.Equal(t, 50, loadUserServiceConfig(t).MaxGetAllUsers)
+}
+
+// failingUpdateRepository fails every update, to exercise self-test cleanup
+type failingUpdateRepository struct {
+	*repository.InMemoryUserRepository
+}
+
+func (r failingUpdateRepository) Update(ctx context.Context, user *models.User) error {
+	return errors.New("update unavailable")
+}
+
+func TestSelfTest(t *testing.T) {
+	recorder := setupSpanRecorder(t)
+	gin.SetMode(gin.TestMode)
+
+	userRepo := repository.NewInMemoryUserRepository()
+	userService := services.NewUserService(userRepo)
+	events, unsubscribe := userService.SubscribeUserEvents()
+	defer unsubscribe()
+	router := gin.New()
+	router.GET("/api/selftest", handlers.NewUserHandler(userService).SelfTest)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/selftest", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Data models.SelfTestReport `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	report := response.Data
+	assert.True(t, report.Success)
+	assert.True(t, report.CleanedUp)
+	assert.True(t, strings.HasPrefix(report.Email, "selftest-"))
+
+	var names []string
+	for _, step := range report.Steps {
+		names = append(names, step.Name)
+		assert.True(t, step.Success, step.Name)
+		assert.Empty(t, step.Error)
+	}
+	assert.Equal(t, []string{"create", "read", "update", "delete"}, names)
+	assert.NotNil(t, findSpan(recorder, "UserService.RunSelfTest"))
+
+	// The throwaway user is gone, and subscribers saw it come and go
+	users, _ := userRepo.GetAll(context.Background())
+	assert.Empty(t, users)
+
+	var types []string
+	for len(events) > 0 {
+		event := <-events
+		assert.Equal(t, report.Email, event.User.Email)
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{models.UserEventCreated, models.UserEventUpdated, models.UserEventDeleted}, types)
+}
+
+func TestSelfTestCleansUpAfterFailure(t *testing.T) {
+	userRepo := failingUpdateRepository{repository.NewInMemoryUserRepository()}
+	userService := services.NewUserService(userRepo)
+
+	report := userService.RunSelfTest(context.Background())
+	assert.False(t, report.Success)
+	assert.True(t, report.CleanedUp)
+	assert.Len(t, report.Steps, 3)
+	assert.True(t, report.Steps[1].Success)
+	assert.False(t, report.Steps[2].Success)
+	assert.Equal(t, "update unavailable", report.Steps[2].Error)
+
+	users, _ := userRepo.GetAll(context.Background())
+	assert.Empty(t, users)
+
+	// Failures are reported with 503
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/selftest", handlers.NewUserHandler(userService).SelfTest)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/selftest", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"cleaned_up":true`)
+
+	// The failure honors the configured error format and keeps the report
+	utils.SetErrorFormat(utils.ErrorFormatProblem)
+	defer utils.SetErrorFormat(utils.ErrorFormatEnvelope)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	var problem struct {
+		Status int                   `json:"status"`
+		Detail string                `json:"detail"`
+		Data   models.SelfTestReport `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, http.StatusServiceUnavailable, problem.Status)
+	assert.Equal(t, "Self-test failed", problem.Detail)
+	assert.False(t, problem.Data.Success)
+	assert.True(t, problem.Data.CleanedUp)
+}
+
+func TestSelfTestEndpointDisabledInProduction(t *testing.T) {
+	t.Setenv("SELFTEST_ENDPOINT", "true")
+	t.Setenv("ENVIRONMENT", "development")
+	assert.True(t, loadConfig(t).SelfTestEndpoint)
+
+	t.Setenv("ENVIRONMENT", "production")
+	assert.False(t, loadConfig(t).SelfTestEndpoint)
+}
+
+func TestDebugStatsEndpointConfig(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "development")
+	t.Setenv("DEBUG_STATS_ENDPOINT", "")
+	assert.False(t, loadConfig(t).DebugStatsEndpoint)
+
+	t.Setenv("DEBUG_STATS_ENDPOINT", "true")
+	assert.True(t, loadConfig(t).DebugStatsEndpoint)
+
+	t.Setenv("ENVIRONMENT", "production")
+	assert.False(t, loadConfig(t).DebugStatsEndpoint)
+}
+
+// racingUserRepository runs a hook after ListPage has read its page, simulating a write
+// that lands between the read and the cache fill
+type racingUserRepository struct {
+	*repository.InMemoryUserRepository
+	afterListPage func()
+}
+
+func (r *racingUserRepository) ListPage(ctx context.Context, offset, limit int) ([]*models.User, int, error) {
+	users, total, err := r.InMemoryUserRepository.ListPage(ctx, offset, limit)
+	if hook := r.afterListPage; hook != nil {
+		r.afterListPage = nil
+		hook()
+	}
+	return users, total, err
+}
+
+func TestListUsersCacheSkipsPagesReadBeforeWrite(t *testing.T) {
+	repo := &racingUserRepository{InMemoryUserRepository: repository.NewInMemoryUserRepository()}
+	userService, err := services.NewUserServiceWithConfig(repo, services.UserServiceConfig{
+		ListCacheTTL: time.Minute,
+	})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = userService.CreateUser(ctx, models.CreateUserRequest{FirstName: "Race", LastName: "One", Email: "race1@example.com"})
+	assert.NoError(t, err)
+
+	repo.afterListPage = func() {
+		_, err := userService.CreateUser(ctx, models.CreateUserRequest{FirstName: "Race", LastName: "Two", Email: "race2@example.com"})
+		assert.NoError(t, err)
+	}
+	_, total, err := userService.ListUsers(ctx, 1, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+
+	// The pre-write page was not cached, so the write is visible
+	_, total, err = userService.ListUsers(ctx, 1, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+}
+
+// failingCreateRepository fails the next create, to check rate limit slots are returned
+type failingCreateRepository struct {
+	*repository.InMemoryUserRepository
+	fail bool
+}
+
+func (r *failingCreateRepository) Create(ctx context.Context, user *models.User) error {
+	if r.fail {
+		r.fail = false
+		return errors.New("create unavailable")
+	}
+	return r.InMemoryUserRepository.Create(ctx, user)
+}
+
+func TestDomainCreateLimitBulkAndFailedCreates(t *testing.T) {
+	repo := &failingCreateRepository{InMemoryUserRepository: repository.NewInMemoryUserRepository()}
+	userService, err := services.NewUserServiceWithConfig(repo, services.UserServiceConfig{
+		DomainCreateLimit:  2,
+		DomainCreateWindow: time.Hour,
+	})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	// A create that fails after reserving a slot gives it back
+	repo.fail = true
+	_, err = userService.CreateUser(ctx, models.CreateUserRequest{FirstName: "Slot", LastName: "Lost", Email: "lost@bulk.example.com"})
+	assert.EqualError(t, err, "create unavailable")
+
+	// Bulk creates share the limit; updates to stored users don't count against it
+	results, err := userService.BulkUpsertUsers(ctx, []models.CreateUserRequest{
+		{FirstName: "Bulk", LastName: "One", Email: "one@bulk.example.com"},
+		{FirstName: "Bulk", LastName: "Two", Email: "two@bulk.example.com"},
+		{FirstName: "Bulk", LastName: "Three", Email: "three@bulk.example.com"},
+		{FirstName: "Bulk", LastName: "Again", Email: "one@bulk.example.com"},
+	})
+	assert.NoError(t, err)
+
+	var statuses []string
+	for _, result := range results {
+		statuses = append(statuses, result.Status)
+	}
+	assert.Equal(t, []string{models.BulkStatusCreated, models.BulkStatusCreated, models.BulkStatusError, models.BulkStatusUpdated}, statuses)
+	assert.Equal(t, services.ErrDomainRateLimited.Error(), results[2].Error)
+
+	_, err = userService.CreateUser(ctx, models.CreateUserRequest{FirstName: "Single", LastName: "Create", Email: "four@bulk.example.com"})
+	assert.ErrorIs(t, err, services.ErrDomainRateLimited)
+}
+
+func TestFindDuplicatesNamePairsAndScanLimit(t *testing.T) {
+	recorder := setupSpanRecorder(t)
+	userRepo := repository.NewInMemoryUserRepository()
+	ctx := context.Background()
+	for _, req := range []models.CreateUserRequest{
+		{FirstName: "Ann", LastName: "Lee", Email: "ann.lee@example.com"},
+		{FirstName: "Ann", LastName: "Leo", Email: "ann.leo@example.com"},
+		{FirstName: "Jan", LastName: "Leo", Email: "jan.leo@example.com"},
+	} {
+		assert.NoError(t, userRepo.Create(ctx, models.NewUser(req)))
+	}
+
+	userService, err := services.NewUserServiceWithConfig(userRepo, services.UserServiceConfig{DuplicateScanLimit: 3})
+	assert.NoError(t, err)
+
+	// Similar names are reported pairwise; Ann Lee and Jan Leo are not chained together
+	groups, err := userService.FindDuplicates(ctx)
+	assert.NoError(t, err)
+	var pairs [][]string
+	for _, group := range groups {
+		assert.Equal(t, []string{"name"}, group.Reasons)
+		var emails []string
+		for _, user := range group.Users {
+			emails = append(emails, user.Email)
+		}
+		pairs = append(pairs, emails)
+	}
+	assert.Equal(t, [][]string{
+		{"ann.lee@example.com", "ann.leo@example.com"},
+		{"ann.leo@example.com", "jan.leo@example.com"},
+	}, pairs)
+
+	// Scans above the cap are refused before users are loaded
+	assert.NoError(t, userRepo.Create(ctx, models.NewUser(models.CreateUserRequest{FirstName: "Extra", LastName: "User", Email: "extra@example.com"})))
+	_, err = userService.FindDuplicates(ctx)
+	assert.ErrorIs(t, err, services.ErrDuplicateScanTooLarge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/users/duplicates", handlers.NewUserHandler(userService).FindDuplicates)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/users/duplicates", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// The refusal is typed on the handler span like other validation failures
+	span := findSpan(recorder, "FindDuplicates")
+	if assert.NotNil(t, span) {
+		var errorType string
+		for _, attr := range span.Attributes() {
+			if attr.Key == tracing.AttrErrorType {
+				errorType = attr.Value.AsString()
+			}
+		}
+		assert.Equal(t, "validation_error", errorType)
+	}
+}
@@ -1,21 +1,42 @@
 package middleware
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"math/rand"
+	"mime"
+	"net"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
+	"user-api/logging"
+	"user-api/models"
+	"user-api/repository"
 	"user-api/tracing"
+	"user-api/utils"
 
 	"github.com/gin-gonic/gin"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
 // Logger middleware for logging HTTP requests with trace correlation
-func Logger() gin.HandlerFunc {
+func Logger(config logging.LoggingConfig) gin.HandlerFunc {
 	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		traceID := tracing.GetTraceID(param.Request.Context())
-		spanID := tracing.GetSpanID(param.Request.Context())
+		if !shouldLogRequest(config, param) {
+			return ""
+		}
 
 		logMsg := fmt.Sprintf("[%s] %s %s %d %s %s",
 			param.TimeStamp.Format(time.RFC3339),
@@ -26,11 +47,14 @@ func Logger() gin.HandlerFunc {
 			param.ClientIP,
 		)
 
-		if traceID != "" {
-			logMsg += fmt.Sprintf(" trace_id=%s", traceID)
+		logMsg += traceLogFields(param.Request.Context())
+
+		if count, ok := param.Keys[dbOperationCountKey]; ok {
+			logMsg += fmt.Sprintf(" db_ops=%d", count)
 		}
-		if spanID != "" {
-			logMsg += fmt.Sprintf(" span_id=%s", spanID)
+
+		if config.IncludeSampled && tracing.GetTraceID(param.Request.Context()) != "" {
+			logMsg += fmt.Sprintf(" sampled=%t", tracing.IsSampled(param.Request.Context()))
 		}
 
 		log.Println(logMsg)
@@ -38,9 +62,61 @@ func Logger() gin.HandlerFunc {
 	})
 }
 
-// TracingMiddleware returns OpenTelemetry tracing middleware
-func TracingMiddleware(serviceName string) gin.HandlerFunc {
-	return otelgin.Middleware(serviceName)
+// shouldLogRequest applies log sampling. Errors and slow requests are always logged;
+// fast 2xx requests are logged at the configured sample rate, or always when it is unset.
+func shouldLogRequest(config logging.LoggingConfig, param gin.LogFormatterParams) bool {
+	if config.SampleRate == nil || *config.SampleRate >= 1 {
+		return true
+	}
+	if param.StatusCode < 200 || param.StatusCode >= 300 {
+		return true
+	}
+	if config.SlowThreshold > 0 && param.Latency >= config.SlowThreshold {
+		return true
+	}
+	return rand.Float64() < *config.SampleRate
+}
+
+// traceLogFields returns the trace correlation fields for a log line.
+// Unsampled requests are omitted since their traces are never exported.
+func traceLogFields(ctx context.Context) string {
+	if !tracing.IsSampled(ctx) {
+		return ""
+	}
+
+	var fields string
+	if traceID := tracing.GetTraceID(ctx); traceID != "" {
+		fields += fmt.Sprintf(" trace_id=%s", traceID)
+	}
+	if spanID := tracing.GetSpanID(ctx); spanID != "" {
+		fields += fmt.Sprintf(" span_id=%s", spanID)
+	}
+	return fields
+}
+
+// TracingMiddleware returns OpenTelemetry tracing middleware. Requests to ignoredPaths
+// (e.g. health probes) are not traced.
+func TracingMiddleware(serviceName string, ignoredPaths ...string) gin.HandlerFunc {
+	if len(ignoredPaths) == 0 {
+		return otelgin.Middleware(serviceName)
+	}
+
+	ignored := make(map[string]bool, len(ignoredPaths))
+	for _, path := range ignoredPaths {
+		ignored[path] = true
+	}
+	return otelgin.Middleware(serviceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return !ignored[r.URL.Path]
+	}))
+}
+
+// TraceResponseHeaders injects the current trace context (e.g. traceparent) into the
+// response headers so client SDKs can correlate their spans with ours
+func TraceResponseHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		otel.GetTextMapPropagator().Inject(c.Request.Context(), propagation.HeaderCarrier(c.Writer.Header()))
+		c.Next()
+	}
 }
 
 // EnhancedTracingMiddleware adds additional tracing attributes
@@ -62,22 +138,28 @@ func EnhancedTracingMiddleware() gin.HandlerFunc {
 			span.SetAttributes(tracing.AttrRequestSize.Int64(c.Request.ContentLength))
 		}
 
+		// Mark the request timeline; untraced and ignored requests skip the events
+		recording := span.IsRecording()
+		start := time.Now()
+		if recording {
+			span.AddEvent("request.received", trace.WithAttributes(
+				tracing.AttrHTTPMethod.String(c.Request.Method),
+				attribute.String("http.path", c.Request.URL.Path),
+			))
+		}
+
 		// Process request
 		c.Next()
 
-		// Add response attributes
-		span.SetAttributes(
-			tracing.AttrHTTPStatusCode.Int(c.Writer.Status()),
-			tracing.AttrResponseSize.Int(c.Writer.Size()),
-		)
-
-		// Record error if status code indicates an error
-		if c.Writer.Status() >= 400 {
-			span.SetAttributes(
-				tracing.AttrErrorType.String("http_error"),
-				tracing.AttrErrorMessage.String(fmt.Sprintf("HTTP %d", c.Writer.Status())),
-			)
+		if recording {
+			span.AddEvent("request.completed", trace.WithAttributes(
+				tracing.AttrHTTPStatusCode.Int(c.Writer.Status()),
+				attribute.Int64("duration_ms", time.Since(start).Milliseconds()),
+			))
 		}
+
+		// Add response attributes, flagging error status codes
+		span.SetAttributes(tracing.HTTPResponseAttributes(c.Writer.Status(), c.Writer.Size())...)
 	}
 }
 
@@ -97,12 +179,13 @@ func CORS() gin.HandlerFunc {
 	}
 }
 
-// JSONContentType middleware ensures content type is application/json for POST/PUT requests
-func JSONContentType() gin.HandlerFunc {
+// JSONContentType middleware ensures content type is application/json for POST/PUT requests.
+// Media type parameters such as charset are accepted; allowSubtypes also admits
+// structured-syntax subtypes like application/vnd.example+json.
+func JSONContentType(allowSubtypes bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if c.Request.Method == "POST" || c.Request.Method == "PUT" {
-			contentType := c.GetHeader("Content-Type")
-			if contentType != "application/json" {
+			if !isJSONMediaType(c.GetHeader("Content-Type"), allowSubtypes) {
 				c.JSON(400, gin.H{
 					"status":  "error",
 					"message": "Content-Type must be application/json",
@@ -115,20 +198,498 @@ func JSONContentType() gin.HandlerFunc {
 	}
 }
 
-// Recovery middleware for handling panics with tracing
-func Recovery() gin.HandlerFunc {
+// isJSONMediaType reports whether contentType is application/json, or an application/*+json
+// subtype when allowSubtypes is set, ignoring any parameters
+func isJSONMediaType(contentType string, allowSubtypes bool) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if mediaType == "application/json" {
+		return true
+	}
+	return allowSubtypes && strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json")
+}
+
+// QueryParamLimit middleware rejects requests with more than maxParams query parameters
+// (maxParams <= 0 disables the count) or with repeated keys for parameters that only
+// accept a single value
+func QueryParamLimit(maxParams int, singleValueParams ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := c.Request.URL.Query()
+
+		count := 0
+		for _, values := range query {
+			count += len(values)
+		}
+		if maxParams > 0 && count > maxParams {
+			utils.ErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("Too many query parameters (max %d)", maxParams), nil)
+			c.Abort()
+			return
+		}
+
+		for _, param := range singleValueParams {
+			if len(query[param]) > 1 {
+				utils.ErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("Query parameter %q must not be repeated", param), nil)
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// GzipDecompression middleware transparently decompresses gzip-encoded request bodies,
+// refusing decompressed output above maxDecompressedBytes with 413 to guard against zip bombs
+func GzipDecompression(maxDecompressedBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.EqualFold(c.GetHeader("Content-Encoding"), "gzip") {
+			c.Next()
+			return
+		}
+
+		gz, err := gzip.NewReader(c.Request.Body)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Malformed gzip request body", nil)
+			c.Abort()
+			return
+		}
+		defer gz.Close()
+
+		// Read one byte past the limit so oversized output is detected without reading it all
+		body, err := io.ReadAll(io.LimitReader(gz, maxDecompressedBytes+1))
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Malformed gzip request body", nil)
+			c.Abort()
+			return
+		}
+		if int64(len(body)) > maxDecompressedBytes {
+			trace.SpanFromContext(c.Request.Context()).SetAttributes(
+				tracing.AttrErrorType.String("body_too_large"),
+			)
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("Decompressed request body exceeds the %d byte limit", maxDecompressedBytes), nil)
+			c.Abort()
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Request.Header.Del("Content-Encoding")
+		c.Request.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		c.Request.ContentLength = int64(len(body))
+
+		c.Next()
+	}
+}
+
+// ContentLengthCheck middleware rejects write requests whose body length differs from the
+// declared Content-Length, surfacing truncated uploads from flaky clients or proxies.
+// The body is buffered so handlers can still bind it; declared lengths above maxBodyBytes
+// are refused with 413 before anything is read.
+func ContentLengthCheck(maxBodyBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			c.Next()
+			return
+		}
+
+		declared := c.Request.ContentLength
+		if declared < 0 || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+
+		if declared > maxBodyBytes {
+			span := trace.SpanFromContext(c.Request.Context())
+			span.SetAttributes(
+				tracing.AttrErrorType.String("body_too_large"),
+				attribute.Int64("http.request.content_length", declared),
+			)
+
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("Content-Length %d exceeds the %d byte limit", declared, maxBodyBytes), nil)
+			c.Abort()
+			return
+		}
+
+		// Read one byte past the declared length so oversized bodies are detected too
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, declared+1))
+		if err != nil || int64(len(body)) != declared {
+			log.Printf("Content-Length mismatch on %s %s: declared %d, read %d bytes",
+				c.Request.Method, c.Request.URL.Path, declared, len(body))
+
+			span := trace.SpanFromContext(c.Request.Context())
+			span.SetAttributes(
+				tracing.AttrErrorType.String("content_length_mismatch"),
+				attribute.Int64("http.request.content_length", declared),
+				attribute.Int("http.request.body_read_bytes", len(body)),
+			)
+
+			utils.ErrorResponse(c, http.StatusBadRequest,
+				fmt.Sprintf("Request body length %d does not match Content-Length %d", len(body), declared), nil)
+			c.Abort()
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}
+
+// RequiredHeaders middleware rejects requests missing any of the given headers.
+// Route groups can apply their own set by registering the middleware with different headers.
+func RequiredHeaders(headers ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var missing []string
+		for _, header := range headers {
+			if c.GetHeader(header) == "" {
+				missing = append(missing, header)
+			}
+		}
+
+		if len(missing) > 0 {
+			span := trace.SpanFromContext(c.Request.Context())
+			span.SetAttributes(
+				tracing.AttrErrorType.String("missing_required_headers"),
+				attribute.StringSlice("http.request.missing_headers", missing),
+			)
+
+			utils.ErrorResponse(c, http.StatusBadRequest, "Missing required headers: "+strings.Join(missing, ", "), nil)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// dbOperationCountKey is the gin context key holding the request's repository operation count.
+// The count is kept on the gin context because outer middleware may restore the original request.
+const dbOperationCountKey = "db.operation.count"
+
+// DBOperationCounter middleware counts repository operations made while serving the
+// request, recording the total as db.operation.count on the span and in the request log
+func DBOperationCounter() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := repository.WithOperationCounter(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		count, _ := repository.OperationCount(ctx)
+		c.Set(dbOperationCountKey, count)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Int64("db.operation.count", count))
+	}
+}
+
+// SafeMethodGuard is a development aid that logs an error when a GET, HEAD or OPTIONS
+// request changes the state reported by snapshot (e.g. the repository's user count),
+// catching accidental mutations in read handlers. Concurrent writes can cause false positives,
+// so it should not run in production.
+func SafeMethodGuard(snapshot func(ctx context.Context) (int, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			c.Next()
+			return
+		}
+
+		before, err := snapshot(c.Request.Context())
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		c.Next()
+
+		after, err := snapshot(c.Request.Context())
+		if err != nil || after == before {
+			return
+		}
+
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(
+			attribute.Bool("safe_method.violation", true),
+		)
+		log.Printf("ERROR: safe method %s %s changed state (user count %d -> %d)",
+			c.Request.Method, c.FullPath(), before, after)
+	}
+}
+
+// inflightRequests is the number of requests currently being served
+var inflightRequests atomic.Int64
+
+// InflightRequests returns the number of requests currently being served
+func InflightRequests() int64 {
+	return inflightRequests.Load()
+}
+
+// Inflight middleware tracks the number of in-flight requests, recording it on the
+// request span and optionally in the X-Inflight response header as an autoscaling signal
+func Inflight(exposeHeader bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		current := inflightRequests.Add(1)
+		defer inflightRequests.Add(-1)
+
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(
+			attribute.Int64("http.server.inflight_requests", current),
+		)
+		if exposeHeader {
+			c.Header("X-Inflight", strconv.FormatInt(current, 10))
+		}
+
+		c.Next()
+	}
+}
+
+// maxClientFieldLength caps client name and version attribute values
+const maxClientFieldLength = 64
+
+// ClientAttribution middleware records which client SDK made the request as span
+// attributes. The name and version come from X-Client-Name/X-Client-Version, falling
+// back to the first User-Agent product token. client.bucket is the name when it is in
+// knownClients and "other" otherwise, so it stays low-cardinality for metric labels.
+func ClientAttribution(knownClients ...string) gin.HandlerFunc {
+	known := make(map[string]bool, len(knownClients))
+	for _, client := range knownClients {
+		known[strings.ToLower(client)] = true
+	}
+
+	return func(c *gin.Context) {
+		name, version := parseClient(c)
+
+		bucket := "other"
+		if known[name] {
+			bucket = name
+		}
+		c.Set("client.bucket", bucket)
+
+		attrs := []attribute.KeyValue{attribute.String("client.bucket", bucket)}
+		if name != "" {
+			attrs = append(attrs, attribute.String("client.name", name))
+		}
+		if version != "" {
+			attrs = append(attrs, attribute.String("client.version", version))
+		}
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(attrs...)
+
+		c.Next()
+	}
+}
+
+// parseClient extracts the client name and version from the request headers
+func parseClient(c *gin.Context) (name, version string) {
+	name = c.GetHeader("X-Client-Name")
+	version = c.GetHeader("X-Client-Version")
+	if name == "" {
+		// e.g. "user-api-go/1.4.0 (linux; amd64)"
+		if product, _, _ := strings.Cut(c.GetHeader("User-Agent"), " "); product != "" {
+			name, version, _ = strings.Cut(product, "/")
+		}
+	}
+	return truncate(strings.ToLower(strings.TrimSpace(name))), truncate(strings.TrimSpace(version))
+}
+
+// truncate shortens s to maxClientFieldLength bytes
+func truncate(s string) string {
+	if len(s) > maxClientFieldLength {
+		return s[:maxClientFieldLength]
+	}
+	return s
+}
+
+// apiVersionKey is the gin context key holding the resolved API version
+const apiVersionKey = "api_version"
+
+// APIVersioning middleware resolves the requested API version from the X-API-Version
+// header, or the version parameter of the Accept header (e.g. "application/json; version=2"),
+// falling back to defaultVersion. Unsupported versions are rejected with 400.
+// Handlers read the result with GetAPIVersion.
+func APIVersioning(defaultVersion string, supported ...string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(supported))
+	for _, version := range supported {
+		allowed[version] = true
+	}
+
+	return func(c *gin.Context) {
+		version := strings.TrimSpace(c.GetHeader("X-API-Version"))
+		if version == "" {
+			if _, params, err := mime.ParseMediaType(c.GetHeader("Accept")); err == nil {
+				version = params["version"]
+			}
+		}
+		if version == "" {
+			version = defaultVersion
+		}
+
+		span := trace.SpanFromContext(c.Request.Context())
+		if !allowed[version] {
+			span.SetAttributes(
+				tracing.AttrErrorType.String("unsupported_api_version"),
+				attribute.String("api.version", version),
+			)
+
+			utils.ErrorResponse(c, http.StatusBadRequest,
+				"Unsupported API version: "+version+" (supported: "+strings.Join(supported, ", ")+")", nil)
+			c.Abort()
+			return
+		}
+
+		span.SetAttributes(attribute.String("api.version", version))
+		c.Set(apiVersionKey, version)
+		c.Next()
+	}
+}
+
+// GetAPIVersion returns the API version resolved by APIVersioning, or "" if it did not run
+func GetAPIVersion(c *gin.Context) string {
+	return c.GetString(apiVersionKey)
+}
+
+// ListParams middleware parses and validates the pagination and filter query parameters
+// of list endpoints once, rejecting invalid values with 400. Handlers read the result
+// with utils.GetListParams.
+func ListParams() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		params, err := utils.ParseListParams(c)
+		if err != nil {
+			span := trace.SpanFromContext(c.Request.Context())
+			tracing.RecordError(span, err)
+			span.SetAttributes(tracing.AttrErrorType.String("validation_error"))
+			utils.ValidationErrorResponse(c, err)
+			c.Abort()
+			return
+		}
+
+		utils.SetListParams(c, params)
+		c.Next()
+	}
+}
+
+// ParseCIDRs parses CIDR ranges, accepting bare IPs as single-address ranges
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil {
+				bits := 128
+				if ip.To4() != nil {
+					bits = 32
+				}
+				value = fmt.Sprintf("%s/%d", value, bits)
+			}
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", value, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// IPFilter middleware rejects requests whose client IP is in a denied range, or outside
+// the allowed ranges when any are configured. Deny takes precedence over allow.
+// The client IP honors forwarding headers only from the engine's trusted proxies.
+func IPFilter(allow, deny []*net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := net.ParseIP(c.ClientIP())
+
+		blocked := ip == nil || containsIP(deny, ip) || (len(allow) > 0 && !containsIP(allow, ip))
+		if blocked {
+			trace.SpanFromContext(c.Request.Context()).SetAttributes(
+				tracing.AttrErrorType.String("ip_blocked"),
+				tracing.AttrHTTPClientIP.String(c.ClientIP()),
+			)
+
+			utils.ErrorResponse(c, http.StatusForbidden, "Access denied", nil)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// containsIP reports whether any of the networks contains ip
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// UUIDPattern matches canonical UUID path parameters
+var UUIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ValidatePathParam middleware trims the named path parameter and rejects values
+// that don't match the pattern, so handlers can assume clean input
+func ValidatePathParam(name string, pattern *regexp.Regexp) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for i, param := range c.Params {
+			if param.Key != name {
+				continue
+			}
+
+			value := strings.TrimSpace(param.Value)
+			if !pattern.MatchString(value) {
+				rejectPathParam(c, fmt.Errorf("invalid path parameter %q", name))
+				return
+			}
+			c.Params[i].Value = value
+		}
+		c.Next()
+	}
+}
+
+// ValidateIDParam validates the named ID path parameter like ValidatePathParam, first
+// verifying and stripping its checksum suffix when ID checksums are enabled
+func ValidateIDParam(name string, pattern *regexp.Regexp) gin.HandlerFunc {
+	validate := ValidatePathParam(name, pattern)
+	return func(c *gin.Context) {
+		for i, param := range c.Params {
+			if param.Key != name {
+				continue
+			}
+
+			id, err := models.ParseExternalID(strings.TrimSpace(param.Value))
+			if err != nil {
+				rejectPathParam(c, fmt.Errorf("invalid path parameter %q: %w", name, err))
+				return
+			}
+			c.Params[i].Value = id
+		}
+		validate(c)
+	}
+}
+
+// rejectPathParam aborts the request with a 400 validation error, as ListParams does
+func rejectPathParam(c *gin.Context, err error) {
+	span := trace.SpanFromContext(c.Request.Context())
+	tracing.RecordError(span, err)
+	span.SetAttributes(tracing.AttrErrorType.String("validation_error"))
+	utils.ValidationErrorResponse(c, err)
+	c.Abort()
+}
+
+// maxPanicStackBytes caps the stack trace included in development panic responses
+const maxPanicStackBytes = 4096
+
+// Recovery middleware for handling panics with tracing. When exposeDetails is set the
+// 500 response also carries the panic value and a truncated stack; never enable it in production.
+func Recovery(exposeDetails bool) gin.HandlerFunc {
 	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
 		traceID := tracing.GetTraceID(c.Request.Context())
-		spanID := tracing.GetSpanID(c.Request.Context())
 
 		// Log panic with trace correlation
 		logMsg := fmt.Sprintf("Panic recovered: %v", recovered)
-		if traceID != "" {
-			logMsg += fmt.Sprintf(" trace_id=%s", traceID)
-		}
-		if spanID != "" {
-			logMsg += fmt.Sprintf(" span_id=%s", spanID)
-		}
+		logMsg += traceLogFields(c.Request.Context())
 		log.Println(logMsg)
 
 		// Record error in span
@@ -151,6 +712,16 @@ func Recovery() gin.HandlerFunc {
 			response["trace_id"] = traceID
 		}
 
+		// Include the panic value and a truncated stack to speed up local debugging
+		if exposeDetails {
+			stack := debug.Stack()
+			if len(stack) > maxPanicStackBytes {
+				stack = stack[:maxPanicStackBytes]
+			}
+			response["panic"] = fmt.Sprintf("%v", recovered)
+			response["stack"] = string(stack)
+		}
+
 		c.JSON(500, response)
 	})
 }
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// acceptCamelCase controls whether create requests also accept camelCase keys
+var acceptCamelCase bool
+
+// SetAcceptCamelCase sets whether CreateUserRequest accepts camelCase aliases such as
+// firstName for its snake_case keys. Responses are always snake_case.
+func SetAcceptCamelCase(enabled bool) {
+	acceptCamelCase = enabled
+}
+
+// createUserRequestAliases maps camelCase request keys to their snake_case names
+var createUserRequestAliases = map[string]string{
+	"firstName":   "first_name",
+	"lastName":    "last_name",
+	"dateOfBirth": "date_of_birth",
+}
+
+// addressAliases maps camelCase address keys to their snake_case names
+var addressAliases = map[string]string{
+	"postalCode": "postal_code",
+}
+
+// UnmarshalJSON decodes the request, mapping camelCase keys to snake_case when enabled
+func (r *CreateUserRequest) UnmarshalJSON(data []byte) error {
+	type plain CreateUserRequest
+	if !acceptCamelCase {
+		return json.Unmarshal(data, (*plain)(r))
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		// Not an object; let the standard decoder report it
+		return json.Unmarshal(data, (*plain)(r))
+	}
+	if err := renameAliases(fields, createUserRequestAliases); err != nil {
+		return err
+	}
+
+	if raw, ok := fields["address"]; ok {
+		var address map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &address); err == nil && address != nil {
+			if err := renameAliases(address, addressAliases); err != nil {
+				return err
+			}
+			if fields["address"], err = json.Marshal(address); err != nil {
+				return err
+			}
+		}
+	}
+
+	normalized, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(normalized, (*plain)(r))
+}
+
+// renameAliases moves aliased keys to their canonical names, rejecting payloads that set both
+func renameAliases(fields map[string]json.RawMessage, aliases map[string]string) error {
+	for alias, canonical := range aliases {
+		value, ok := fields[alias]
+		if !ok {
+			continue
+		}
+		if _, exists := fields[canonical]; exists {
+			return fmt.Errorf("both %q and %q were provided; use one", alias, canonical)
+		}
+		fields[canonical] = value
+		delete(fields, alias)
+	}
+	return nil
+}
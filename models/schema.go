@@ -0,0 +1,95 @@
+package models
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FieldSchema describes a request field and its validation rules
+type FieldSchema struct {
+	Name     string        `json:"name"`
+	Type     string        `json:"type"`
+	Required bool          `json:"required"`
+	Min      *int          `json:"min,omitempty"`
+	Max      *int          `json:"max,omitempty"`
+	Format   string        `json:"format,omitempty"`
+	Fields   []FieldSchema `json:"fields,omitempty"`
+}
+
+// formatTags maps validate tags to schema formats
+var formatTags = map[string]string{
+	"email":              "email",
+	"datetime":           "date",
+	"bcp47_language_tag": "bcp47",
+}
+
+// CreateUserRequestSchema describes the fields accepted when creating a user
+func CreateUserRequestSchema() []FieldSchema {
+	return structSchema(reflect.TypeOf(CreateUserRequest{}))
+}
+
+// structSchema derives field schemas from a struct's json and validate tags
+func structSchema(t reflect.Type) []FieldSchema {
+	fields := make([]FieldSchema, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		// Fields tagged binding:"-" are read-only and not accepted on input
+		if name == "" || name == "-" || !field.IsExported() || field.Tag.Get("binding") == "-" {
+			continue
+		}
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		schema := FieldSchema{Name: name, Type: schemaType(fieldType)}
+		if fieldType.Kind() == reflect.Struct {
+			schema.Fields = structSchema(fieldType)
+		}
+
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+			tag, param, _ := strings.Cut(rule, "=")
+			switch tag {
+			case "required":
+				schema.Required = true
+			case "min":
+				if n, err := strconv.Atoi(param); err == nil {
+					schema.Min = &n
+				}
+			case "max":
+				if n, err := strconv.Atoi(param); err == nil {
+					schema.Max = &n
+				}
+			default:
+				if format, ok := formatTags[tag]; ok {
+					schema.Format = format
+				}
+			}
+		}
+
+		fields = append(fields, schema)
+	}
+	return fields
+}
+
+// schemaType maps a Go type to its JSON type name
+func schemaType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -1,6 +1,11 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,9 +19,13 @@ type User struct {
 	Email       string    `json:"email" validate:"required,email"`
 	Phone       string    `json:"phone,omitempty" validate:"omitempty,min=10,max=15"`
 	DateOfBirth string    `json:"date_of_birth,omitempty" validate:"omitempty,datetime=2006-01-02"`
+	Locale      string    `json:"locale,omitempty" validate:"omitempty,bcp47_language_tag"`
 	Address     *Address  `json:"address,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	// DeletedAt is set only on tombstones, which record a deletion for incremental sync
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 // Address represents a user's address
@@ -26,18 +35,31 @@ type Address struct {
 	State      string `json:"state,omitempty" validate:"omitempty,max=50"`
 	PostalCode string `json:"postal_code,omitempty" validate:"omitempty,max=20"`
 	Country    string `json:"country,omitempty" validate:"omitempty,max=50"`
+	// Latitude and Longitude are set by the geocoder; values sent by clients are dropped
+	Latitude  *float64 `json:"latitude,omitempty" binding:"-"`
+	Longitude *float64 `json:"longitude,omitempty" binding:"-"`
 }
 
 // CreateUserRequest represents the request payload for creating a user
 type CreateUserRequest struct {
 	FirstName   string   `json:"first_name" validate:"required,min=2,max=50"`
 	LastName    string   `json:"last_name" validate:"required,min=2,max=50"`
-	Email       string   `json:"email" validate:"required,email"`
+	Email       string   `json:"email" validate:"required,email,strict_email,email_domain"`
 	Phone       string   `json:"phone,omitempty" validate:"omitempty,min=10,max=15"`
 	DateOfBirth string   `json:"date_of_birth,omitempty" validate:"omitempty,datetime=2006-01-02"`
+	Locale      string   `json:"locale,omitempty" validate:"omitempty,bcp47_language_tag"`
 	Address     *Address `json:"address,omitempty"`
 }
 
+// UpdateUserRequest represents the request payload for replacing a user's fields.
+// It accepts and validates the same fields as CreateUserRequest.
+type UpdateUserRequest CreateUserRequest
+
+// UnmarshalJSON decodes the request like a create request, including camelCase aliases
+func (r *UpdateUserRequest) UnmarshalJSON(data []byte) error {
+	return (*CreateUserRequest)(r).UnmarshalJSON(data)
+}
+
 // NewUser creates a new user from a create request
 func NewUser(req CreateUserRequest) *User {
 	now := time.Now()
@@ -48,43 +70,276 @@ func NewUser(req CreateUserRequest) *User {
 		Email:       req.Email,
 		Phone:       req.Phone,
 		DateOfBirth: req.DateOfBirth,
-		Address:     req.Address,
+		Locale:      req.Locale,
+		Address:     newAddress(req.Address),
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
 }
 
-// GetFullName returns the user's full name
+// newAddress copies a requested address without its coordinates, which only the geocoder sets
+func newAddress(req *Address) *Address {
+	if req == nil {
+		return nil
+	}
+	address := *req
+	address.Latitude = nil
+	address.Longitude = nil
+	return &address
+}
+
+// NewTombstone records the deletion of user at deletedAt. It keeps only the ID and
+// timestamps, with UpdatedAt set to the deletion so tombstones order with other changes.
+func NewTombstone(user *User, deletedAt time.Time) *User {
+	return &User{
+		ID:        user.ID,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: deletedAt,
+		DeletedAt: &deletedAt,
+	}
+}
+
+// Full name formats
+const (
+	NameFormatFirstLast = "first_last"
+	NameFormatLastFirst = "last_first"
+)
+
+// nameFormat and nameSeparator control how full names are built
+var (
+	nameFormat    = NameFormatFirstLast
+	nameSeparator = " "
+)
+
+// SetNameFormat sets the default full name order and the separator placed between names
+func SetNameFormat(format, separator string) error {
+	if err := ValidateNameFormat(format); err != nil {
+		return err
+	}
+	nameFormat = format
+	nameSeparator = separator
+	return nil
+}
+
+// ValidateNameFormat reports whether format is a supported full name format
+func ValidateNameFormat(format string) error {
+	if format != NameFormatFirstLast && format != NameFormatLastFirst {
+		return fmt.Errorf("name format must be %q or %q", NameFormatFirstLast, NameFormatLastFirst)
+	}
+	return nil
+}
+
+// formatName joins first and last names in the given format with the configured separator
+func formatName(firstName, lastName, format string) string {
+	if format == NameFormatLastFirst {
+		return lastName + nameSeparator + firstName
+	}
+	return firstName + nameSeparator + lastName
+}
+
+// GetFullName returns the user's full name in the configured format
 func (u *User) GetFullName() string {
-	return u.FirstName + " " + u.LastName
+	return formatName(u.FirstName, u.LastName, nameFormat)
 }
 
 // UserResponse represents the response format for user data
 type UserResponse struct {
-	ID          string    `json:"id"`
-	FirstName   string    `json:"first_name"`
-	LastName    string    `json:"last_name"`
-	FullName    string    `json:"full_name"`
-	Email       string    `json:"email"`
-	Phone       string    `json:"phone,omitempty"`
-	DateOfBirth string    `json:"date_of_birth,omitempty"`
-	Address     *Address  `json:"address,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          string     `json:"id"`
+	FirstName   string     `json:"first_name"`
+	LastName    string     `json:"last_name"`
+	FullName    string     `json:"full_name"`
+	Email       string     `json:"email"`
+	Phone       string     `json:"phone,omitempty"`
+	DateOfBirth string     `json:"date_of_birth,omitempty"`
+	Locale      string     `json:"locale,omitempty"`
+	Address     *Address   `json:"address,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+
+	// Transformations lists normalizations applied to the request, when requested
+	Transformations []string `json:"transformations,omitempty"`
 }
 
 // ToResponse converts a User to UserResponse
 func (u *User) ToResponse() UserResponse {
 	return UserResponse{
-		ID:          u.ID,
+		ID:          ExternalID(u.ID),
 		FirstName:   u.FirstName,
 		LastName:    u.LastName,
 		FullName:    u.GetFullName(),
 		Email:       u.Email,
 		Phone:       u.Phone,
 		DateOfBirth: u.DateOfBirth,
+		Locale:      u.Locale,
 		Address:     u.Address,
 		CreatedAt:   u.CreatedAt,
 		UpdatedAt:   u.UpdatedAt,
+		DeletedAt:   u.DeletedAt,
 	}
 }
+
+// nullOptionals controls whether empty optional response fields serialize as null or are omitted
+var nullOptionals bool
+
+// SetNullOptionals sets whether empty optional fields (phone, date_of_birth, locale, address)
+// are serialized as explicit null instead of being omitted
+func SetNullOptionals(enabled bool) {
+	nullOptionals = enabled
+}
+
+// MarshalJSON omits empty optional fields by default, or writes them as null when enabled
+func (r UserResponse) MarshalJSON() ([]byte, error) {
+	type plain UserResponse
+	if !nullOptionals {
+		return json.Marshal(plain(r))
+	}
+
+	// Shallower fields shadow the embedded omitempty ones
+	return json.Marshal(struct {
+		plain
+		Phone       *string  `json:"phone"`
+		DateOfBirth *string  `json:"date_of_birth"`
+		Locale      *string  `json:"locale"`
+		Address     *Address `json:"address"`
+	}{
+		plain:       plain(r),
+		Phone:       optionalString(r.Phone),
+		DateOfBirth: optionalString(r.DateOfBirth),
+		Locale:      optionalString(r.Locale),
+		Address:     r.Address,
+	})
+}
+
+// idChecksum controls whether IDs are emitted with a checksum suffix
+var idChecksum bool
+
+// SetIDChecksum sets whether IDs in responses carry a checksum suffix that ID path
+// parameters must then include
+func SetIDChecksum(enabled bool) {
+	idChecksum = enabled
+}
+
+// ErrInvalidIDChecksum is returned by ParseExternalID when the checksum suffix is missing
+// or doesn't match the ID
+var ErrInvalidIDChecksum = errors.New("id checksum is missing or invalid")
+
+// idChecksumSeparator separates an ID from its checksum suffix
+const idChecksumSeparator = "."
+
+// ExternalID returns id as clients see it: with a CRC-32 checksum suffix when ID
+// checksums are enabled, and unchanged otherwise
+func ExternalID(id string) string {
+	if !idChecksum {
+		return id
+	}
+	return fmt.Sprintf("%s%s%08x", id, idChecksumSeparator, crc32.ChecksumIEEE([]byte(id)))
+}
+
+// ParseExternalID verifies and strips the checksum suffix of a client-supplied ID when
+// ID checksums are enabled, returning the stored ID
+func ParseExternalID(value string) (string, error) {
+	if !idChecksum {
+		return value, nil
+	}
+	index := strings.LastIndex(value, idChecksumSeparator)
+	if index < 0 {
+		return "", ErrInvalidIDChecksum
+	}
+	id := value[:index]
+	if ExternalID(id) != value {
+		return "", ErrInvalidIDChecksum
+	}
+	return id, nil
+}
+
+// optionalString returns nil for an empty string so it serializes as null
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// WithNameFormat returns a copy of the response with the full name rebuilt in the given format
+func (r UserResponse) WithNameFormat(format string) UserResponse {
+	r.FullName = formatName(r.FirstName, r.LastName, format)
+	return r
+}
+
+// InLocation returns a copy of the response with timestamps converted to the given location
+func (r UserResponse) InLocation(loc *time.Location) UserResponse {
+	r.CreatedAt = r.CreatedAt.In(loc)
+	r.UpdatedAt = r.UpdatedAt.In(loc)
+	if r.DeletedAt != nil {
+		deletedAt := r.DeletedAt.In(loc)
+		r.DeletedAt = &deletedAt
+	}
+	return r
+}
+
+// User change event types
+const (
+	UserEventCreated = "created"
+	UserEventUpdated = "updated"
+	UserEventDeleted = "deleted"
+)
+
+// UserEvent describes a change to a user, streamed to event subscribers
+type UserEvent struct {
+	Type       string       `json:"type"`
+	User       UserResponse `json:"user"`
+	OccurredAt time.Time    `json:"occurred_at"`
+}
+
+// Bulk upsert result statuses
+const (
+	BulkStatusCreated = "created"
+	BulkStatusUpdated = "updated"
+	BulkStatusError   = "error"
+)
+
+// BulkUpsertResult represents the outcome of a single item in a bulk upsert
+type BulkUpsertResult struct {
+	Index  int           `json:"index"`
+	Email  string        `json:"email"`
+	Status string        `json:"status"`
+	User   *UserResponse `json:"user,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// FieldError describes a single field that failed validation
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationResult represents the validation outcome of a single item in a batch
+type ValidationResult struct {
+	Index  int          `json:"index"`
+	Valid  bool         `json:"valid"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// DuplicateGroup is a set of users that are likely the same person
+type DuplicateGroup struct {
+	Reasons []string       `json:"reasons"`
+	Users   []UserResponse `json:"users"`
+}
+
+// SelfTestStep reports the outcome and timing of one step of a self-test
+type SelfTestStep struct {
+	Name       string  `json:"name"`
+	Success    bool    `json:"success"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// SelfTestReport summarizes a self-test run against the full create/read/update/delete path
+type SelfTestReport struct {
+	Success   bool           `json:"success"`
+	Email     string         `json:"email"`
+	Steps     []SelfTestStep `json:"steps"`
+	CleanedUp bool           `json:"cleaned_up"`
+}
@@ -0,0 +1,682 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+	"user-api/models"
+	"user-api/tracing"
+
+	bolt "go.etcd.io/bbolt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Bolt bucket names: users maps ID to the user's JSON, emails maps email to ID,
+// created orders IDs by creation time for paging, and tombstones maps the ID of a
+// deleted user to its tombstone's JSON
+var (
+	usersBucket      = []byte("users")
+	emailsBucket     = []byte("emails")
+	createdBucket    = []byte("created")
+	tombstonesBucket = []byte("tombstones")
+)
+
+// BoltUserRepository implements UserRepository on an embedded BoltDB file,
+// persisting users across restarts on a single node
+type BoltUserRepository struct {
+	db        *bolt.DB
+	path      string
+	retention time.Duration
+	tracer    trace.Tracer
+}
+
+// NewBoltUserRepository opens the BoltDB file at path, creating it and its buckets if needed
+func NewBoltUserRepository(path string) (*BoltUserRepository, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(usersBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(emailsBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(tombstonesBucket); err != nil {
+			return err
+		}
+		return ensureCreatedIndex(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltUserRepository{
+		db:        db,
+		path:      path,
+		retention: DefaultTombstoneRetention,
+		tracer:    tracing.GetTracer("user-api/repository"),
+	}, nil
+}
+
+// SetTombstoneRetention sets how long tombstones are kept; zero keeps them forever.
+// Clients whose last sync is older than the retention must do a full resync.
+// Call it before the repository is shared.
+func (r *BoltUserRepository) SetTombstoneRetention(retention time.Duration) {
+	r.retention = retention
+}
+
+// Close releases the database file
+func (r *BoltUserRepository) Close() error {
+	return r.db.Close()
+}
+
+// Create adds a new user to the repository
+func (r *BoltUserRepository) Create(ctx context.Context, user *models.User) error {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "BoltUserRepository.Create")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("create"),
+		tracing.AttrDBTable.String("users"),
+		tracing.AttrUserID.String(user.ID),
+		tracing.AttrUserEmail.String(user.Email),
+	)
+
+	// Enforce email uniqueness in the same transaction as the insert
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(emailsBucket).Get([]byte(user.Email)) != nil {
+			return ErrDuplicateEmail
+		}
+		return putUser(tx, user)
+	})
+	if err != nil {
+		recordBoltError(span, err)
+		return err
+	}
+
+	tracing.AddSpanAttributes(span, attribute.String("operation.result", "success"))
+	return nil
+}
+
+// GetByID retrieves a user by ID
+func (r *BoltUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "BoltUserRepository.GetByID")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("get_by_id"),
+		tracing.AttrDBTable.String("users"),
+		tracing.AttrUserID.String(id),
+	)
+
+	var user *models.User
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var err error
+		user, err = getUser(tx, id)
+		return err
+	})
+	if err != nil {
+		recordBoltError(span, err)
+		return nil, err
+	}
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrUserEmail.String(user.Email),
+		attribute.String("operation.result", "success"),
+	)
+	return user, nil
+}
+
+// GetByEmail retrieves a user by email
+func (r *BoltUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "BoltUserRepository.GetByEmail")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("get_by_email"),
+		tracing.AttrDBTable.String("users"),
+		tracing.AttrUserEmail.String(email),
+	)
+
+	var user *models.User
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var err error
+		user, err = getUserByEmail(tx, email)
+		return err
+	})
+	if err != nil {
+		recordBoltError(span, err)
+		return nil, err
+	}
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrUserID.String(user.ID),
+		attribute.String("operation.result", "success"),
+	)
+	return user, nil
+}
+
+// GetAll retrieves all users
+func (r *BoltUserRepository) GetAll(ctx context.Context) ([]*models.User, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "BoltUserRepository.GetAll")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("get_all"),
+		tracing.AttrDBTable.String("users"),
+	)
+
+	users, err := r.allUsers()
+	if err != nil {
+		recordBoltError(span, err)
+		return nil, err
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("users.count", len(users)),
+		attribute.String("operation.result", "success"),
+	)
+	return users, nil
+}
+
+// GetAllIDs retrieves all user IDs ordered by creation time
+func (r *BoltUserRepository) GetAllIDs(ctx context.Context) ([]string, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "BoltUserRepository.GetAllIDs")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("get_all_ids"),
+		tracing.AttrDBTable.String("users"),
+	)
+
+	users, err := r.allUsers()
+	if err != nil {
+		recordBoltError(span, err)
+		return nil, err
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].ID < users[j].ID
+		}
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+
+	ids := make([]string, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("users.count", len(ids)),
+		attribute.String("operation.result", "success"),
+	)
+	return ids, nil
+}
+
+// ListPage retrieves up to limit users starting at offset, ordered by creation time,
+// along with the total number of users. Only the users on the page are decoded.
+func (r *BoltUserRepository) ListPage(ctx context.Context, offset, limit int) ([]*models.User, int, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "BoltUserRepository.ListPage")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("list_page"),
+		tracing.AttrDBTable.String("users"),
+		attribute.Int("page.offset", offset),
+		attribute.Int("page.limit", limit),
+	)
+
+	users := make([]*models.User, 0)
+	var total int
+	err := r.db.View(func(tx *bolt.Tx) error {
+		total = tx.Bucket(usersBucket).Stats().KeyN
+		cursor := tx.Bucket(createdBucket).Cursor()
+		skipped := 0
+		for key, id := cursor.First(); key != nil && len(users) < limit; key, id = cursor.Next() {
+			if skipped < offset {
+				skipped++
+				continue
+			}
+			user, err := getUser(tx, string(id))
+			if err != nil {
+				return err
+			}
+			users = append(users, user)
+		}
+		return nil
+	})
+	if err != nil {
+		recordBoltError(span, err)
+		return nil, 0, err
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("users.count", len(users)),
+		attribute.Int("users.total", total),
+		attribute.String("operation.result", "success"),
+	)
+	return users, total, nil
+}
+
+// ChangedSince retrieves users updated at or after since, together with tombstones of
+// users deleted at or after since, ordered by update time
+func (r *BoltUserRepository) ChangedSince(ctx context.Context, since time.Time) ([]*models.User, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "BoltUserRepository.ChangedSince")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("changed_since"),
+		tracing.AttrDBTable.String("users"),
+		attribute.String("changed_since", since.Format(time.RFC3339Nano)),
+	)
+
+	users := make([]*models.User, 0)
+	cutoff := tombstoneCutoff(r.retention, time.Now())
+	err := r.db.View(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{usersBucket, tombstonesBucket} {
+			expired := time.Time{}
+			if bytes.Equal(bucket, tombstonesBucket) {
+				expired = cutoff
+			}
+			err := tx.Bucket(bucket).ForEach(func(_, data []byte) error {
+				var user models.User
+				if err := json.Unmarshal(data, &user); err != nil {
+					return err
+				}
+				if !user.UpdatedAt.Before(since) && !user.UpdatedAt.Before(expired) {
+					users = append(users, &user)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		recordBoltError(span, err)
+		return nil, err
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].UpdatedAt.Equal(users[j].UpdatedAt) {
+			return users[i].ID < users[j].ID
+		}
+		return users[i].UpdatedAt.Before(users[j].UpdatedAt)
+	})
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("users.count", len(users)),
+		attribute.String("operation.result", "success"),
+	)
+	return users, nil
+}
+
+// Update updates an existing user
+func (r *BoltUserRepository) Update(ctx context.Context, user *models.User) error {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "BoltUserRepository.Update")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("update"),
+		tracing.AttrDBTable.String("users"),
+		tracing.AttrUserID.String(user.ID),
+		tracing.AttrUserEmail.String(user.Email),
+	)
+
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		existing, err := getUser(tx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		// Another user may not already hold the new email
+		if id := tx.Bucket(emailsBucket).Get([]byte(user.Email)); id != nil && string(id) != user.ID {
+			return ErrDuplicateEmail
+		}
+		if existing.Email != user.Email {
+			if err := tx.Bucket(emailsBucket).Delete([]byte(existing.Email)); err != nil {
+				return err
+			}
+		}
+		return putUser(tx, user)
+	})
+	if err != nil {
+		recordBoltError(span, err)
+		return err
+	}
+
+	tracing.AddSpanAttributes(span, attribute.String("operation.result", "success"))
+	return nil
+}
+
+// Upsert creates the user if the email is new or updates the existing user with that email.
+// It reports whether a new user was created.
+func (r *BoltUserRepository) Upsert(ctx context.Context, user *models.User) (bool, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "BoltUserRepository.Upsert")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("upsert"),
+		tracing.AttrDBTable.String("users"),
+		tracing.AttrUserEmail.String(user.Email),
+	)
+
+	created := false
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		existing, err := getUserByEmail(tx, user.Email)
+		if err == nil {
+			// Keep the stored identity and creation time
+			user.ID = existing.ID
+			user.CreatedAt = existing.CreatedAt
+		} else {
+			created = true
+		}
+		return putUser(tx, user)
+	})
+	if err != nil {
+		recordBoltError(span, err)
+		return false, err
+	}
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrUserID.String(user.ID),
+		attribute.Bool("upsert.created", created),
+		attribute.String("operation.result", "success"),
+	)
+	return created, nil
+}
+
+// GetOrCreate returns the existing user with the same email, or stores user when the email
+// is new. The lookup and insert happen in one transaction, so concurrent callers create at
+// most one user per email. It reports whether user was created.
+func (r *BoltUserRepository) GetOrCreate(ctx context.Context, user *models.User) (*models.User, bool, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "BoltUserRepository.GetOrCreate")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("get_or_create"),
+		tracing.AttrDBTable.String("users"),
+		tracing.AttrUserEmail.String(user.Email),
+	)
+
+	result := user
+	created := false
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		if existing, err := getUserByEmail(tx, user.Email); err == nil {
+			result = existing
+			return nil
+		}
+		created = true
+		return putUser(tx, user)
+	})
+	if err != nil {
+		recordBoltError(span, err)
+		return nil, false, err
+	}
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrUserID.String(result.ID),
+		attribute.Bool("get_or_create.created", created),
+		attribute.String("operation.result", "success"),
+	)
+	return result, created, nil
+}
+
+// Delete removes a user from the repository
+func (r *BoltUserRepository) Delete(ctx context.Context, id string) error {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "BoltUserRepository.Delete")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("delete"),
+		tracing.AttrDBTable.String("users"),
+		tracing.AttrUserID.String(id),
+	)
+
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		user, err := getUser(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(emailsBucket).Delete([]byte(user.Email)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(createdBucket).Delete(createdKey(id, user)); err != nil {
+			return err
+		}
+		now := time.Now()
+		tombstone, err := json.Marshal(models.NewTombstone(user, now))
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(tombstonesBucket).Put([]byte(id), tombstone); err != nil {
+			return err
+		}
+		if err := pruneTombstones(tx, tombstoneCutoff(r.retention, now)); err != nil {
+			return err
+		}
+		return tx.Bucket(usersBucket).Delete([]byte(id))
+	})
+	if err != nil {
+		recordBoltError(span, err)
+		return err
+	}
+
+	tracing.AddSpanAttributes(span, attribute.String("operation.result", "success"))
+	return nil
+}
+
+// Stats returns the user count and the size of the database file
+func (r *BoltUserRepository) Stats(ctx context.Context) (RepoStats, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "BoltUserRepository.Stats")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("stats"),
+		tracing.AttrDBTable.String("users"),
+	)
+
+	var count int
+	var size int64
+	err := r.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(usersBucket).Stats().KeyN
+		size = tx.Size()
+		return nil
+	})
+	if err != nil {
+		recordBoltError(span, err)
+		return RepoStats{}, err
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("users.count", count),
+		attribute.String("operation.result", "success"),
+	)
+	return RepoStats{
+		Backend:   "bolt",
+		UserCount: count,
+		Details: map[string]interface{}{
+			"path":       r.path,
+			"file_bytes": size,
+		},
+	}, nil
+}
+
+// Ping reports whether the database can serve a read transaction
+func (r *BoltUserRepository) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(usersBucket) == nil {
+			return errors.New("users bucket is missing")
+		}
+		return nil
+	})
+}
+
+// allUsers decodes every stored user
+func (r *BoltUserRepository) allUsers() ([]*models.User, error) {
+	users := make([]*models.User, 0)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(usersBucket).ForEach(func(_, data []byte) error {
+			var user models.User
+			if err := json.Unmarshal(data, &user); err != nil {
+				return err
+			}
+			users = append(users, &user)
+			return nil
+		})
+	})
+	return users, err
+}
+
+// getUser decodes the user stored under id
+func getUser(tx *bolt.Tx, id string) (*models.User, error) {
+	data := tx.Bucket(usersBucket).Get([]byte(id))
+	if data == nil {
+		return nil, errors.New("user not found")
+	}
+	var user models.User
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// getUserByEmail resolves email through the email index and decodes the user
+func getUserByEmail(tx *bolt.Tx, email string) (*models.User, error) {
+	id := tx.Bucket(emailsBucket).Get([]byte(email))
+	if id == nil {
+		return nil, errors.New("user not found")
+	}
+	return getUser(tx, string(id))
+}
+
+// pruneTombstones deletes the tombstones of users deleted before cutoff
+func pruneTombstones(tx *bolt.Tx, cutoff time.Time) error {
+	bucket := tx.Bucket(tombstonesBucket)
+	var expired [][]byte
+	err := bucket.ForEach(func(id, data []byte) error {
+		var tombstone models.User
+		if err := json.Unmarshal(data, &tombstone); err != nil {
+			return err
+		}
+		if tombstone.UpdatedAt.Before(cutoff) {
+			expired = append(expired, append([]byte(nil), id...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range expired {
+		if err := bucket.Delete(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putUser stores the user under its ID and indexes it
+func putUser(tx *bolt.Tx, user *models.User) error {
+	return putUserAt(tx, user.ID, user)
+}
+
+// putUserAt stores the user under key and indexes it there. Only integrity repair stores
+// a user under a key other than its ID.
+func putUserAt(tx *bolt.Tx, key string, user *models.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(usersBucket).Put([]byte(key), data); err != nil {
+		return err
+	}
+	if err := tx.Bucket(createdBucket).Put(createdKey(key, user), []byte(key)); err != nil {
+		return err
+	}
+	return tx.Bucket(emailsBucket).Put([]byte(user.Email), []byte(key))
+}
+
+// createdKey orders users by creation time, then the key they are stored under. The sign
+// bit is flipped so pre-1970 timestamps still sort first as unsigned bytes.
+func createdKey(id string, user *models.User) []byte {
+	key := make([]byte, 8, 8+len(id))
+	binary.BigEndian.PutUint64(key, uint64(user.CreatedAt.UnixNano())^(1<<63))
+	return append(key, id...)
+}
+
+// ensureCreatedIndex creates the creation-time index, rebuilding it from the users
+// bucket when it is missing or out of step, e.g. in files written before it existed
+func ensureCreatedIndex(tx *bolt.Tx) error {
+	users := tx.Bucket(usersBucket)
+	if index := tx.Bucket(createdBucket); index != nil {
+		if index.Stats().KeyN == users.Stats().KeyN {
+			return nil
+		}
+		if err := tx.DeleteBucket(createdBucket); err != nil {
+			return err
+		}
+	}
+
+	index, err := tx.CreateBucket(createdBucket)
+	if err != nil {
+		return err
+	}
+	return users.ForEach(func(id, data []byte) error {
+		var user models.User
+		if err := json.Unmarshal(data, &user); err != nil {
+			return err
+		}
+		return index.Put(createdKey(string(id), &user), id)
+	})
+}
+
+// recordBoltError records err on the span with an error type matching the repository contract
+func recordBoltError(span trace.Span, err error) {
+	tracing.RecordError(span, err)
+	switch {
+	case errors.Is(err, ErrDuplicateEmail):
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("duplicate_email"))
+	case err.Error() == "user not found":
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("not_found"))
+	default:
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("database_error"))
+	}
+}
@@ -0,0 +1,315 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"user-api/models"
+	"user-api/tracing"
+
+	bolt "go.etcd.io/bbolt"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// IntegrityChecker is implemented by repositories that can verify and repair their own invariants
+type IntegrityChecker interface {
+	// VerifyIntegrity returns a description of each broken invariant, or none when consistent
+	VerifyIntegrity(ctx context.Context) ([]string, error)
+	// RepairIntegrity rebuilds indexes and returns the problems that remain afterwards
+	RepairIntegrity(ctx context.Context) ([]string, error)
+}
+
+// VerifyIntegrity checks that every user is indexed under its own non-empty ID
+// and that no two users share an email
+func (r *InMemoryUserRepository) VerifyIntegrity(ctx context.Context) ([]string, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "InMemoryUserRepository.VerifyIntegrity")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("verify_integrity"),
+		tracing.AttrDBTable.String("users"),
+	)
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	problems := r.integrityProblems()
+	tracing.AddSpanAttributes(span,
+		attribute.Int("integrity.problems", len(problems)),
+		attribute.String("operation.result", "success"),
+	)
+	return problems, nil
+}
+
+// RepairIntegrity re-indexes users stored under the wrong key and drops entries without an ID.
+// Duplicate IDs and emails need a human decision, so they are left in place and reported.
+func (r *InMemoryUserRepository) RepairIntegrity(ctx context.Context) ([]string, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "InMemoryUserRepository.RepairIntegrity")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("repair_integrity"),
+		tracing.AttrDBTable.String("users"),
+	)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	rebuilt, dropped := rekeyUsers(r.users)
+	r.users = rebuilt
+
+	problems := r.integrityProblems()
+	tracing.AddSpanAttributes(span,
+		attribute.Int("integrity.dropped", dropped),
+		attribute.Int("integrity.problems", len(problems)),
+		attribute.String("operation.result", "success"),
+	)
+	return problems, nil
+}
+
+// integrityProblems lists broken invariants in a stable order; callers must hold the mutex
+func (r *InMemoryUserRepository) integrityProblems() []string {
+	problems := userIntegrityProblems(r.users)
+	sort.Strings(problems)
+	return problems
+}
+
+// rekeyUsers returns users keyed by their own IDs, dropping entries without an ID, along
+// with the number dropped. Users sharing an ID, and users whose ID is the key of one of
+// them, stay under their current keys so no valid user is overwritten.
+func rekeyUsers(users map[string]*models.User) (map[string]*models.User, int) {
+	keysByID := make(map[string][]string)
+	for key, user := range users {
+		if user.ID != "" {
+			keysByID[user.ID] = append(keysByID[user.ID], key)
+		}
+	}
+
+	inPlace := make(map[string]bool)
+	for _, keys := range keysByID {
+		if len(keys) > 1 {
+			for _, key := range keys {
+				inPlace[key] = true
+			}
+		}
+	}
+	// Moving a user onto a key held in place would overwrite it, so hold that user too
+	for changed := true; changed; {
+		changed = false
+		for key, user := range users {
+			if user.ID != "" && !inPlace[key] && user.ID != key && inPlace[user.ID] {
+				inPlace[key] = true
+				changed = true
+			}
+		}
+	}
+
+	rebuilt := make(map[string]*models.User, len(users))
+	dropped := 0
+	for key, user := range users {
+		switch {
+		case user.ID == "":
+			dropped++
+		case inPlace[key]:
+			rebuilt[key] = user
+		default:
+			rebuilt[user.ID] = user
+		}
+	}
+	return rebuilt, dropped
+}
+
+// userIntegrityProblems lists users stored under a key other than their non-empty ID,
+// IDs and emails shared by several users. Emails are compared exactly, as Create and
+// Update do.
+func userIntegrityProblems(users map[string]*models.User) []string {
+	problems := make([]string, 0)
+	ids := make(map[string][]string)
+	emails := make(map[string][]string)
+	for key, user := range users {
+		switch {
+		case user.ID == "":
+			problems = append(problems, fmt.Sprintf("user stored under %q has an empty ID", key))
+		case user.ID != key:
+			problems = append(problems, fmt.Sprintf("user %q is indexed under %q", user.ID, key))
+		}
+		if user.ID != "" {
+			ids[user.ID] = append(ids[user.ID], key)
+		}
+		emails[user.Email] = append(emails[user.Email], key)
+	}
+	for id, keys := range ids {
+		if len(keys) > 1 {
+			sort.Strings(keys)
+			problems = append(problems, fmt.Sprintf("ID %q is shared by users stored under %s", id, strings.Join(keys, ", ")))
+		}
+	}
+	for email, keys := range emails {
+		if len(keys) > 1 {
+			sort.Strings(keys)
+			problems = append(problems, fmt.Sprintf("email %q is shared by users %s", email, strings.Join(keys, ", ")))
+		}
+	}
+	return problems
+}
+
+// VerifyIntegrity checks that every user is stored under its own non-empty ID, that no two
+// users share an email, and that the email and creation-time indexes match the users
+func (r *BoltUserRepository) VerifyIntegrity(ctx context.Context) ([]string, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "BoltUserRepository.VerifyIntegrity")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("verify_integrity"),
+		tracing.AttrDBTable.String("users"),
+	)
+
+	var problems []string
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var err error
+		problems, err = boltIntegrityProblems(tx)
+		return err
+	})
+	if err != nil {
+		recordBoltError(span, err)
+		return nil, err
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("integrity.problems", len(problems)),
+		attribute.String("operation.result", "success"),
+	)
+	return problems, nil
+}
+
+// RepairIntegrity re-keys users stored under the wrong key, drops entries without an ID,
+// and rebuilds the email and creation-time indexes from the users. Duplicate IDs and
+// emails need a human decision, so they are left in place and reported.
+func (r *BoltUserRepository) RepairIntegrity(ctx context.Context) ([]string, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "BoltUserRepository.RepairIntegrity")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("repair_integrity"),
+		tracing.AttrDBTable.String("users"),
+	)
+
+	var problems []string
+	var dropped int
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		users, err := boltUsersByKey(tx)
+		if err != nil {
+			return err
+		}
+		var rebuilt map[string]*models.User
+		rebuilt, dropped = rekeyUsers(users)
+
+		for _, bucket := range [][]byte{usersBucket, emailsBucket, createdBucket} {
+			if err := tx.DeleteBucket(bucket); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(bucket); err != nil {
+				return err
+			}
+		}
+
+		// Index shared emails under the first key so repairs are deterministic
+		keys := make([]string, 0, len(rebuilt))
+		for key := range rebuilt {
+			keys = append(keys, key)
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+		for _, key := range keys {
+			if err := putUserAt(tx, key, rebuilt[key]); err != nil {
+				return err
+			}
+		}
+
+		problems, err = boltIntegrityProblems(tx)
+		return err
+	})
+	if err != nil {
+		recordBoltError(span, err)
+		return nil, err
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("integrity.dropped", dropped),
+		attribute.Int("integrity.problems", len(problems)),
+		attribute.String("operation.result", "success"),
+	)
+	return problems, nil
+}
+
+// boltUsersByKey decodes every user keyed by the key it is stored under
+func boltUsersByKey(tx *bolt.Tx) (map[string]*models.User, error) {
+	users := make(map[string]*models.User)
+	err := tx.Bucket(usersBucket).ForEach(func(key, data []byte) error {
+		var user models.User
+		if err := json.Unmarshal(data, &user); err != nil {
+			return fmt.Errorf("user stored under %q is not valid JSON: %w", key, err)
+		}
+		users[string(key)] = &user
+		return nil
+	})
+	return users, err
+}
+
+// boltIntegrityProblems lists broken user invariants and index entries that don't match
+// the users, in a stable order
+func boltIntegrityProblems(tx *bolt.Tx) ([]string, error) {
+	users, err := boltUsersByKey(tx)
+	if err != nil {
+		return nil, err
+	}
+	problems := userIntegrityProblems(users)
+
+	// Every user's email resolves to a user with that email, and every entry to a user
+	err = tx.Bucket(emailsBucket).ForEach(func(email, id []byte) error {
+		user, ok := users[string(id)]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("email index entry %q points to missing user %q", email, id))
+		case user.Email != string(email):
+			problems = append(problems, fmt.Sprintf("email index entry %q points to user %q with email %q", email, id, user.Email))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for key, user := range users {
+		if tx.Bucket(emailsBucket).Get([]byte(user.Email)) == nil {
+			problems = append(problems, fmt.Sprintf("email %q of user %q is not indexed", user.Email, key))
+		}
+	}
+
+	// The creation-time index holds exactly one entry per user
+	indexed := 0
+	err = tx.Bucket(createdBucket).ForEach(func(_, id []byte) error {
+		indexed++
+		if _, ok := users[string(id)]; !ok {
+			problems = append(problems, fmt.Sprintf("creation index points to missing user %q", id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if indexed != len(users) {
+		problems = append(problems, fmt.Sprintf("creation index has %d entries for %d users", indexed, len(users)))
+	}
+
+	sort.Strings(problems)
+	return problems, nil
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// opCounterKey is the context key for the request-scoped operation counter
+type opCounterKey struct{}
+
+// WithOperationCounter returns a context that counts repository operations
+// performed with it, so N+1 access patterns show up per request
+func WithOperationCounter(ctx context.Context) context.Context {
+	return context.WithValue(ctx, opCounterKey{}, new(atomic.Int64))
+}
+
+// OperationCount returns the number of repository operations counted in ctx
+// and whether a counter is present
+func OperationCount(ctx context.Context) (int64, bool) {
+	counter, ok := ctx.Value(opCounterKey{}).(*atomic.Int64)
+	if !ok {
+		return 0, false
+	}
+	return counter.Load(), true
+}
+
+// countOperation increments the operation counter in ctx, if any
+func countOperation(ctx context.Context) {
+	if counter, ok := ctx.Value(opCounterKey{}).(*atomic.Int64); ok {
+		counter.Add(1)
+	}
+}
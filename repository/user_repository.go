@@ -3,7 +3,10 @@ package repository
 import (
 	"context"
 	"errors"
+	"sort"
 	"sync"
+	"time"
+	"unsafe"
 	"user-api/models"
 	"user-api/tracing"
 
@@ -11,37 +14,71 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
+// ErrDuplicateEmail is returned by Create when another user already has the email
+var ErrDuplicateEmail = errors.New("user with this email already exists")
+
 // UserRepository defines the interface for user data operations
 type UserRepository interface {
 	Create(ctx context.Context, user *models.User) error
 	GetByID(ctx context.Context, id string) (*models.User, error)
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
 	GetAll(ctx context.Context) ([]*models.User, error)
+	GetAllIDs(ctx context.Context) ([]string, error)
+	ListPage(ctx context.Context, offset, limit int) ([]*models.User, int, error)
+	ChangedSince(ctx context.Context, since time.Time) ([]*models.User, error)
 	Update(ctx context.Context, user *models.User) error
+	Upsert(ctx context.Context, user *models.User) (bool, error)
+	GetOrCreate(ctx context.Context, user *models.User) (*models.User, bool, error)
 	Delete(ctx context.Context, id string) error
+	Stats(ctx context.Context) (RepoStats, error)
+	Ping(ctx context.Context) error
+}
+
+// RepoStats holds backend-specific repository health information
+type RepoStats struct {
+	Backend   string                 `json:"backend"`
+	UserCount int                    `json:"user_count"`
+	Details   map[string]interface{} `json:"details,omitempty"`
 }
 
 // InMemoryUserRepository implements UserRepository using in-memory storage
 type InMemoryUserRepository struct {
-	users  map[string]*models.User
-	mutex  sync.RWMutex
-	tracer trace.Tracer
+	users      map[string]*models.User
+	tombstones map[string]*models.User // deleted users by ID, for ChangedSince
+	retention  time.Duration
+	mutex      sync.RWMutex
+	tracer     trace.Tracer
 }
 
+// DefaultTombstoneRetention is how long deletions stay visible to ChangedSince
+const DefaultTombstoneRetention = 30 * 24 * time.Hour
+
 // NewInMemoryUserRepository creates a new in-memory user repository
 func NewInMemoryUserRepository() *InMemoryUserRepository {
 	return &InMemoryUserRepository{
-		users:  make(map[string]*models.User),
-		mutex:  sync.RWMutex{},
-		tracer: tracing.GetTracer("user-api/repository"),
+		users:      make(map[string]*models.User),
+		tombstones: make(map[string]*models.User),
+		retention:  DefaultTombstoneRetention,
+		mutex:      sync.RWMutex{},
+		tracer:     tracing.GetTracer("user-api/repository"),
 	}
 }
 
+// SetTombstoneRetention sets how long tombstones are kept; zero keeps them forever.
+// Clients whose last sync is older than the retention must do a full resync.
+func (r *InMemoryUserRepository) SetTombstoneRetention(retention time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.retention = retention
+}
+
 // Create adds a new user to the repository
 func (r *InMemoryUserRepository) Create(ctx context.Context, user *models.User) error {
 	ctx, span := tracing.StartSpan(ctx, r.tracer, "InMemoryUserRepository.Create")
 	defer span.End()
 
+	countOperation(ctx)
+
 	tracing.AddSpanAttributes(span,
 		tracing.AttrDBOperation.String("create"),
 		tracing.AttrDBTable.String("users"),
@@ -52,10 +89,10 @@ func (r *InMemoryUserRepository) Create(ctx context.Context, user *models.User)
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	// Check if user with same email already exists
+	// Enforce email uniqueness under the same lock as the insert
 	for _, existingUser := range r.users {
 		if existingUser.Email == user.Email {
-			err := errors.New("user with this email already exists")
+			err := ErrDuplicateEmail
 			tracing.RecordError(span, err)
 			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("duplicate_email"))
 			return err
@@ -72,6 +109,8 @@ func (r *InMemoryUserRepository) GetByID(ctx context.Context, id string) (*model
 	ctx, span := tracing.StartSpan(ctx, r.tracer, "InMemoryUserRepository.GetByID")
 	defer span.End()
 
+	countOperation(ctx)
+
 	tracing.AddSpanAttributes(span,
 		tracing.AttrDBOperation.String("get_by_id"),
 		tracing.AttrDBTable.String("users"),
@@ -101,6 +140,8 @@ func (r *InMemoryUserRepository) GetByEmail(ctx context.Context, email string) (
 	ctx, span := tracing.StartSpan(ctx, r.tracer, "InMemoryUserRepository.GetByEmail")
 	defer span.End()
 
+	countOperation(ctx)
+
 	tracing.AddSpanAttributes(span,
 		tracing.AttrDBOperation.String("get_by_email"),
 		tracing.AttrDBTable.String("users"),
@@ -131,6 +172,8 @@ func (r *InMemoryUserRepository) GetAll(ctx context.Context) ([]*models.User, er
 	ctx, span := tracing.StartSpan(ctx, r.tracer, "InMemoryUserRepository.GetAll")
 	defer span.End()
 
+	countOperation(ctx)
+
 	tracing.AddSpanAttributes(span,
 		tracing.AttrDBOperation.String("get_all"),
 		tracing.AttrDBTable.String("users"),
@@ -151,11 +194,136 @@ func (r *InMemoryUserRepository) GetAll(ctx context.Context) ([]*models.User, er
 	return users, nil
 }
 
+// GetAllIDs retrieves all user IDs ordered by creation time
+func (r *InMemoryUserRepository) GetAllIDs(ctx context.Context) ([]string, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "InMemoryUserRepository.GetAllIDs")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("get_all_ids"),
+		tracing.AttrDBTable.String("users"),
+	)
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	users := make([]*models.User, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].ID < users[j].ID
+		}
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+
+	ids := make([]string, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("users.count", len(ids)),
+		attribute.String("operation.result", "success"),
+	)
+	return ids, nil
+}
+
+// ListPage retrieves up to limit users starting at offset, ordered by creation time,
+// along with the total number of users
+func (r *InMemoryUserRepository) ListPage(ctx context.Context, offset, limit int) ([]*models.User, int, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "InMemoryUserRepository.ListPage")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("list_page"),
+		tracing.AttrDBTable.String("users"),
+		attribute.Int("page.offset", offset),
+		attribute.Int("page.limit", limit),
+	)
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	users := make([]*models.User, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].ID < users[j].ID
+		}
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+
+	total := len(users)
+	start := min(offset, total)
+	end := min(start+limit, total)
+	page := append([]*models.User(nil), users[start:end]...)
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("users.count", len(page)),
+		attribute.Int("users.total", total),
+		attribute.String("operation.result", "success"),
+	)
+	return page, total, nil
+}
+
+// ChangedSince retrieves users updated at or after since, together with tombstones of
+// users deleted at or after since, ordered by update time
+func (r *InMemoryUserRepository) ChangedSince(ctx context.Context, since time.Time) ([]*models.User, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "InMemoryUserRepository.ChangedSince")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("changed_since"),
+		tracing.AttrDBTable.String("users"),
+		attribute.String("changed_since", since.Format(time.RFC3339Nano)),
+	)
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	users := make([]*models.User, 0)
+	for _, user := range r.users {
+		if !user.UpdatedAt.Before(since) {
+			users = append(users, user)
+		}
+	}
+	cutoff := tombstoneCutoff(r.retention, time.Now())
+	for _, tombstone := range r.tombstones {
+		if !tombstone.UpdatedAt.Before(since) && !tombstone.UpdatedAt.Before(cutoff) {
+			users = append(users, tombstone)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].UpdatedAt.Equal(users[j].UpdatedAt) {
+			return users[i].ID < users[j].ID
+		}
+		return users[i].UpdatedAt.Before(users[j].UpdatedAt)
+	})
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("users.count", len(users)),
+		attribute.String("operation.result", "success"),
+	)
+	return users, nil
+}
+
 // Update updates an existing user
 func (r *InMemoryUserRepository) Update(ctx context.Context, user *models.User) error {
 	ctx, span := tracing.StartSpan(ctx, r.tracer, "InMemoryUserRepository.Update")
 	defer span.End()
 
+	countOperation(ctx)
+
 	tracing.AddSpanAttributes(span,
 		tracing.AttrDBOperation.String("update"),
 		tracing.AttrDBTable.String("users"),
@@ -173,16 +341,108 @@ func (r *InMemoryUserRepository) Update(ctx context.Context, user *models.User)
 		return err
 	}
 
+	// Another user may not already hold the new email
+	for _, existingUser := range r.users {
+		if existingUser.ID != user.ID && existingUser.Email == user.Email {
+			err := ErrDuplicateEmail
+			tracing.RecordError(span, err)
+			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("duplicate_email"))
+			return err
+		}
+	}
+
 	r.users[user.ID] = user
 	tracing.AddSpanAttributes(span, attribute.String("operation.result", "success"))
 	return nil
 }
 
+// Upsert creates the user if the email is new or updates the existing user with that email.
+// It reports whether a new user was created.
+func (r *InMemoryUserRepository) Upsert(ctx context.Context, user *models.User) (bool, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "InMemoryUserRepository.Upsert")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("upsert"),
+		tracing.AttrDBTable.String("users"),
+		tracing.AttrUserEmail.String(user.Email),
+	)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, existingUser := range r.users {
+		if existingUser.Email == user.Email {
+			// Keep the stored identity and creation time
+			user.ID = existingUser.ID
+			user.CreatedAt = existingUser.CreatedAt
+			r.users[user.ID] = user
+
+			tracing.AddSpanAttributes(span,
+				tracing.AttrUserID.String(user.ID),
+				attribute.Bool("upsert.created", false),
+				attribute.String("operation.result", "success"),
+			)
+			return false, nil
+		}
+	}
+
+	r.users[user.ID] = user
+	tracing.AddSpanAttributes(span,
+		tracing.AttrUserID.String(user.ID),
+		attribute.Bool("upsert.created", true),
+		attribute.String("operation.result", "success"),
+	)
+	return true, nil
+}
+
+// GetOrCreate returns the existing user with the same email, or stores user when the email
+// is new. The lookup and insert happen under one lock, so concurrent callers create at most
+// one user per email. It reports whether user was created.
+func (r *InMemoryUserRepository) GetOrCreate(ctx context.Context, user *models.User) (*models.User, bool, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "InMemoryUserRepository.GetOrCreate")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("get_or_create"),
+		tracing.AttrDBTable.String("users"),
+		tracing.AttrUserEmail.String(user.Email),
+	)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, existingUser := range r.users {
+		if existingUser.Email == user.Email {
+			tracing.AddSpanAttributes(span,
+				tracing.AttrUserID.String(existingUser.ID),
+				attribute.Bool("get_or_create.created", false),
+				attribute.String("operation.result", "success"),
+			)
+			return existingUser, false, nil
+		}
+	}
+
+	r.users[user.ID] = user
+	tracing.AddSpanAttributes(span,
+		tracing.AttrUserID.String(user.ID),
+		attribute.Bool("get_or_create.created", true),
+		attribute.String("operation.result", "success"),
+	)
+	return user, true, nil
+}
+
 // Delete removes a user from the repository
 func (r *InMemoryUserRepository) Delete(ctx context.Context, id string) error {
 	ctx, span := tracing.StartSpan(ctx, r.tracer, "InMemoryUserRepository.Delete")
 	defer span.End()
 
+	countOperation(ctx)
+
 	tracing.AddSpanAttributes(span,
 		tracing.AttrDBOperation.String("delete"),
 		tracing.AttrDBTable.String("users"),
@@ -192,14 +452,81 @@ func (r *InMemoryUserRepository) Delete(ctx context.Context, id string) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	if _, exists := r.users[id]; !exists {
+	user, exists := r.users[id]
+	if !exists {
 		err := errors.New("user not found")
 		tracing.RecordError(span, err)
 		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("not_found"))
 		return err
 	}
 
+	now := time.Now()
 	delete(r.users, id)
+	r.tombstones[id] = models.NewTombstone(user, now)
+	cutoff := tombstoneCutoff(r.retention, now)
+	for tombstoneID, tombstone := range r.tombstones {
+		if tombstone.UpdatedAt.Before(cutoff) {
+			delete(r.tombstones, tombstoneID)
+		}
+	}
 	tracing.AddSpanAttributes(span, attribute.String("operation.result", "success"))
 	return nil
 }
+
+// Stats returns the user count and an approximate memory footprint
+func (r *InMemoryUserRepository) Stats(ctx context.Context) (RepoStats, error) {
+	ctx, span := tracing.StartSpan(ctx, r.tracer, "InMemoryUserRepository.Stats")
+	defer span.End()
+
+	countOperation(ctx)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrDBOperation.String("stats"),
+		tracing.AttrDBTable.String("users"),
+	)
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	approxBytes := 0
+	for id, user := range r.users {
+		approxBytes += len(id) + approxUserSize(user)
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("users.count", len(r.users)),
+		attribute.String("operation.result", "success"),
+	)
+	return RepoStats{
+		Backend:   "memory",
+		UserCount: len(r.users),
+		Details: map[string]interface{}{
+			"approx_memory_bytes": approxBytes,
+		},
+	}, nil
+}
+
+// approxUserSize estimates the bytes held by a user's fields
+func approxUserSize(user *models.User) int {
+	size := int(unsafe.Sizeof(*user)) + len(user.ID) + len(user.FirstName) + len(user.LastName) +
+		len(user.Email) + len(user.Phone) + len(user.DateOfBirth) + len(user.Locale)
+	if user.Address != nil {
+		size += int(unsafe.Sizeof(*user.Address)) + len(user.Address.Street) + len(user.Address.City) +
+			len(user.Address.State) + len(user.Address.PostalCode) + len(user.Address.Country)
+	}
+	return size
+}
+
+// Ping reports whether the repository is reachable; the in-memory store always is
+func (r *InMemoryUserRepository) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// tombstoneCutoff returns the deletion time before which tombstones expire, or the
+// zero time when retention is zero and tombstones are kept forever
+func tombstoneCutoff(retention time.Duration, now time.Time) time.Time {
+	if retention <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-retention)
+}
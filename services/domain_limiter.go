@@ -0,0 +1,107 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDomainLimiterEntries bounds the number of tracked domains
+const maxDomainLimiterEntries = 10000
+
+// ErrDomainRateLimited is returned when an email domain exceeds its creation limit
+var ErrDomainRateLimited = errors.New("too many users created for this email domain, try again later")
+
+// domainLimiter caps user creations per email domain in fixed windows
+type domainLimiter struct {
+	limit   int
+	window  time.Duration
+	windows map[string]domainWindow
+	mutex   sync.Mutex
+}
+
+// domainWindow counts creations for a domain in the current window
+type domainWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+// newDomainLimiter creates a domain limiter; a zero limit or window disables it
+func newDomainLimiter(limit int, window time.Duration) *domainLimiter {
+	return &domainLimiter{
+		limit:   limit,
+		window:  window,
+		windows: make(map[string]domainWindow),
+	}
+}
+
+// enabled reports whether limiting is turned on
+func (l *domainLimiter) enabled() bool {
+	return l.limit > 0 && l.window > 0
+}
+
+// allow records a creation for the email's domain and reports whether it is within the limit
+func (l *domainLimiter) allow(email string) bool {
+	if !l.enabled() {
+		return true
+	}
+
+	domain := emailDomain(email)
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	entry, ok := l.windows[domain]
+	if !ok || now.After(entry.resetAt) {
+		if !ok && len(l.windows) >= maxDomainLimiterEntries {
+			l.evictExpired(now)
+			// Refuse new domains rather than dropping live windows, so flooding
+			// throwaway domains can't reset the limits of others
+			if len(l.windows) >= maxDomainLimiterEntries {
+				return false
+			}
+		}
+		entry = domainWindow{resetAt: now.Add(l.window)}
+	}
+
+	if entry.count >= l.limit {
+		l.windows[domain] = entry
+		return false
+	}
+	entry.count++
+	l.windows[domain] = entry
+	return true
+}
+
+// release returns a slot taken by allow when the creation it was reserved for did not happen
+func (l *domainLimiter) release(email string) {
+	if !l.enabled() {
+		return
+	}
+
+	domain := emailDomain(email)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if entry, ok := l.windows[domain]; ok && entry.count > 0 {
+		entry.count--
+		l.windows[domain] = entry
+	}
+}
+
+// evictExpired drops finished windows
+func (l *domainLimiter) evictExpired(now time.Time) {
+	for domain, entry := range l.windows {
+		if now.After(entry.resetAt) {
+			delete(l.windows, domain)
+		}
+	}
+}
+
+// emailDomain returns the lowercased domain of an email address
+func emailDomain(email string) string {
+	return strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+}
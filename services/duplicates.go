@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"user-api/models"
+	"user-api/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxNameDistance is the largest edit distance between full names treated as a likely duplicate
+const maxNameDistance = 2
+
+// Duplicate match reasons
+const (
+	DuplicateReasonEmail = "email"
+	DuplicateReasonPhone = "phone"
+	DuplicateReasonName  = "name"
+)
+
+// ErrDuplicateScanTooLarge is returned by FindDuplicates when there are more users than
+// DuplicateScanLimit or MaxGetAllUsers allows it to load
+var ErrDuplicateScanTooLarge = errors.New("too many users to scan for duplicates")
+
+// DefaultDuplicateScanLimit is the default cap on users compared by FindDuplicates
+const DefaultDuplicateScanLimit = 1000
+
+// FindDuplicates groups users that are likely the same person. Users sharing a normalized
+// email or phone are merged into one group; full names within a small edit distance are
+// reported pairwise only, so "Ann Lee", "Ann Leo", and "Jan Leo" don't chain into one group.
+// Name matching compares every pair of users after loading them all, so the scan is capped
+// at the lower of DuplicateScanLimit and MaxGetAllUsers.
+func (s *UserService) FindDuplicates(ctx context.Context) ([]models.DuplicateGroup, error) {
+	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.FindDuplicates")
+	defer span.End()
+
+	if err := checkContext(ctx, span); err != nil {
+		return nil, err
+	}
+
+	// Check the size before loading anything
+	if limit, setting := s.duplicateScanLimit(); limit > 0 {
+		stats, err := s.repo.Stats(ctx)
+		if err != nil {
+			tracing.RecordError(span, err)
+			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("repository_error"))
+			return nil, err
+		}
+		if stats.UserCount > limit {
+			err := fmt.Errorf("%w: %d users exceed the limit of %d; remove known duplicates or raise %s", ErrDuplicateScanTooLarge, stats.UserCount, limit, setting)
+			tracing.RecordError(span, err)
+			tracing.AddSpanAttributes(span,
+				tracing.AttrErrorType.String("scan_too_large"),
+				attribute.Int("users.count", stats.UserCount),
+				attribute.Int("users.limit", limit),
+			)
+			return nil, err
+		}
+	}
+
+	users, err := s.repo.GetAll(ctx)
+	if err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("repository_error"))
+		return nil, err
+	}
+
+	// Stable order so groups and their members are deterministic
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].ID < users[j].ID
+		}
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+
+	groups := newDuplicateGroups(len(users))
+	names := make([]string, len(users))
+	for i, user := range users {
+		names[i] = strings.ToLower(strings.Join(strings.Fields(user.GetFullName()), " "))
+	}
+
+	// Exact identifiers merge transitively
+	var namePairs [][2]int
+	for i := range users {
+		for j := i + 1; j < len(users); j++ {
+			if email := normalizedEmail(users[i].Email); email != "" && email == normalizedEmail(users[j].Email) {
+				groups.union(i, j, DuplicateReasonEmail)
+			}
+			if phone := normalizedPhone(users[i].Phone); phone != "" && phone == normalizedPhone(users[j].Phone) {
+				groups.union(i, j, DuplicateReasonPhone)
+			}
+			if levenshtein(names[i], names[j]) <= maxNameDistance {
+				namePairs = append(namePairs, [2]int{i, j})
+			}
+		}
+	}
+
+	// Similar names annotate an existing group, or stand alone as a pair
+	var standalone [][2]int
+	for _, pair := range namePairs {
+		if root := groups.find(pair[0]); root == groups.find(pair[1]) {
+			groups.addReason(root, DuplicateReasonName)
+		} else {
+			standalone = append(standalone, pair)
+		}
+	}
+	result := groups.collect(users, standalone)
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("users.count", len(users)),
+		attribute.Int("duplicates.groups", len(result)),
+		attribute.String("operation.result", "success"),
+	)
+	return result, nil
+}
+
+// duplicateScanLimit returns the tighter of the enabled DuplicateScanLimit and MaxGetAllUsers
+// caps, with the env var that raises it, or 0 when both are disabled
+func (s *UserService) duplicateScanLimit() (int, string) {
+	limit, setting := s.config.DuplicateScanLimit, "DUPLICATES_MAX_USERS"
+	if getAll := s.config.MaxGetAllUsers; getAll > 0 && (limit <= 0 || getAll < limit) {
+		limit, setting = getAll, "MAX_GET_ALL_USERS"
+	}
+	return limit, setting
+}
+
+// duplicateGroups is a union-find over user indexes that tracks match reasons per group
+type duplicateGroups struct {
+	parent  []int
+	reasons map[int]map[string]bool
+}
+
+// newDuplicateGroups creates n singleton groups
+func newDuplicateGroups(n int) *duplicateGroups {
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	return &duplicateGroups{parent: parent, reasons: make(map[int]map[string]bool)}
+}
+
+// find returns the root of i's group
+func (g *duplicateGroups) find(i int) int {
+	for g.parent[i] != i {
+		g.parent[i] = g.parent[g.parent[i]]
+		i = g.parent[i]
+	}
+	return i
+}
+
+// union merges the groups of i and j, recording why they matched
+func (g *duplicateGroups) union(i, j int, reason string) {
+	rootI, rootJ := g.find(i), g.find(j)
+	if rootI != rootJ {
+		if rootJ < rootI {
+			rootI, rootJ = rootJ, rootI
+		}
+		g.parent[rootJ] = rootI
+		for r := range g.reasons[rootJ] {
+			g.addReason(rootI, r)
+		}
+		delete(g.reasons, rootJ)
+	}
+	g.addReason(rootI, reason)
+}
+
+// addReason records a match reason on a group root
+func (g *duplicateGroups) addReason(root int, reason string) {
+	if g.reasons[root] == nil {
+		g.reasons[root] = make(map[string]bool)
+	}
+	g.reasons[root][reason] = true
+}
+
+// collect returns the groups with more than one member together with the standalone
+// name pairs, ordered by each group's earliest user
+func (g *duplicateGroups) collect(users []*models.User, namePairs [][2]int) []models.DuplicateGroup {
+	type orderedGroup struct {
+		first int
+		group models.DuplicateGroup
+	}
+
+	members := make(map[int][]models.UserResponse)
+	var roots []int
+	for i, user := range users {
+		root := g.find(i)
+		if _, ok := members[root]; !ok {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], user.ToResponse())
+	}
+
+	var ordered []orderedGroup
+	for _, root := range roots {
+		if len(members[root]) < 2 {
+			continue
+		}
+		reasons := make([]string, 0, len(g.reasons[root]))
+		for reason := range g.reasons[root] {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+		ordered = append(ordered, orderedGroup{root, models.DuplicateGroup{Reasons: reasons, Users: members[root]}})
+	}
+	for _, pair := range namePairs {
+		ordered = append(ordered, orderedGroup{pair[0], models.DuplicateGroup{
+			Reasons: []string{DuplicateReasonName},
+			Users:   []models.UserResponse{users[pair[0]].ToResponse(), users[pair[1]].ToResponse()},
+		}})
+	}
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].first < ordered[j].first })
+
+	groups := make([]models.DuplicateGroup, 0, len(ordered))
+	for _, entry := range ordered {
+		groups = append(groups, entry.group)
+	}
+	return groups
+}
+
+// normalizedEmail lowercases and trims an email for comparison
+func normalizedEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// normalizedPhone keeps only the digits of a phone number for comparison
+func normalizedPhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
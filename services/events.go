@@ -0,0 +1,68 @@
+package services
+
+import (
+	"sync"
+	"time"
+	"user-api/models"
+)
+
+// eventBufferSize is how many events a slow subscriber may fall behind before events are dropped
+const eventBufferSize = 16
+
+// EventBroker fans user change events out to in-process subscribers
+type EventBroker struct {
+	mutex       sync.Mutex
+	subscribers map[chan models.UserEvent]struct{}
+}
+
+// NewEventBroker creates a broker with no subscribers
+func NewEventBroker() *EventBroker {
+	return &EventBroker{subscribers: make(map[chan models.UserEvent]struct{})}
+}
+
+// Subscribe registers a subscriber and returns its event channel and an unsubscribe
+// function that must be called when the subscriber goes away
+func (b *EventBroker) Subscribe() (<-chan models.UserEvent, func()) {
+	events := make(chan models.UserEvent, eventBufferSize)
+
+	b.mutex.Lock()
+	b.subscribers[events] = struct{}{}
+	b.mutex.Unlock()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			b.mutex.Lock()
+			delete(b.subscribers, events)
+			b.mutex.Unlock()
+			close(events)
+		})
+	}
+}
+
+// Publish sends the event to every subscriber without blocking; subscribers whose
+// buffer is full miss the event
+func (b *EventBroker) Publish(event models.UserEvent) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for events := range b.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// publishUserEvent publishes a change of the given type for user
+func (s *UserService) publishUserEvent(eventType string, user *models.User) {
+	s.events.Publish(models.UserEvent{
+		Type:       eventType,
+		User:       user.ToResponse(),
+		OccurredAt: time.Now().UTC(),
+	})
+}
+
+// SubscribeUserEvents streams user created, updated, and deleted events until unsubscribe is called
+func (s *UserService) SubscribeUserEvents() (<-chan models.UserEvent, func()) {
+	return s.events.Subscribe()
+}
@@ -0,0 +1,23 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"user-api/models"
+)
+
+// ErrNoCoordinates is returned by a Geocoder that cannot resolve an address
+var ErrNoCoordinates = errors.New("no coordinates found for address")
+
+// Geocoder resolves an address to latitude/longitude coordinates
+type Geocoder interface {
+	Geocode(ctx context.Context, address models.Address) (lat, lng float64, err error)
+}
+
+// NoopGeocoder is the default Geocoder and never resolves coordinates
+type NoopGeocoder struct{}
+
+// Geocode always returns ErrNoCoordinates
+func (NoopGeocoder) Geocode(ctx context.Context, address models.Address) (float64, float64, error) {
+	return 0, 0, ErrNoCoordinates
+}
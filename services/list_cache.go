@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"user-api/models"
+	"user-api/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxListCacheEntries bounds the number of cached pages
+const maxListCacheEntries = 1000
+
+// listCache caches ListUsers pages until the TTL expires or a write bumps the version
+type listCache struct {
+	ttl     time.Duration
+	version uint64
+	entries map[string]listCacheEntry
+	mutex   sync.Mutex
+}
+
+// listCacheEntry is a cached page of users
+type listCacheEntry struct {
+	users     []*models.User
+	total     int
+	version   uint64
+	expiresAt time.Time
+}
+
+// newListCache creates a list cache; a zero TTL disables caching
+func newListCache(ttl time.Duration) *listCache {
+	return &listCache{
+		ttl:     ttl,
+		entries: make(map[string]listCacheEntry),
+	}
+}
+
+// enabled reports whether caching is turned on
+func (c *listCache) enabled() bool {
+	return c.ttl > 0
+}
+
+// get returns a cached page if it is still fresh
+func (c *listCache) get(page, limit int) ([]*models.User, int, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[listCacheKey(page, limit)]
+	if !ok || entry.version != c.version || time.Now().After(entry.expiresAt) {
+		return nil, 0, false
+	}
+	return append([]*models.User(nil), entry.users...), entry.total, true
+}
+
+// currentVersion returns the cache version, to be read before loading a page from the repository
+func (c *listCache) currentVersion() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.version
+}
+
+// set stores a page read at the given version. The page is dropped if a write
+// invalidated the cache since, so pre-write data is never cached as fresh.
+func (c *listCache) set(page, limit int, version uint64, users []*models.User, total int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if version != c.version {
+		return
+	}
+	if len(c.entries) >= maxListCacheEntries {
+		c.entries = make(map[string]listCacheEntry)
+	}
+	c.entries[listCacheKey(page, limit)] = listCacheEntry{
+		users:     append([]*models.User(nil), users...),
+		total:     total,
+		version:   version,
+		expiresAt: time.Now().Add(c.ttl),
+	}
+}
+
+// invalidate bumps the version so all cached pages become stale
+func (c *listCache) invalidate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.version++
+	c.entries = make(map[string]listCacheEntry)
+}
+
+// listCacheKey builds the cache key for a page
+func listCacheKey(page, limit int) string {
+	return fmt.Sprintf("%d:%d", page, limit)
+}
+
+// WarmListCache preloads the first ListCacheWarmPages pages of the given size into the list
+// cache so the first list requests after startup are served from memory. It stops at the
+// last page or when ListCacheWarmTimeout elapses, and returns the number of pages cached.
+func (s *UserService) WarmListCache(ctx context.Context, limit int) (int, error) {
+	if !s.listCache.enabled() || s.config.ListCacheWarmPages <= 0 || limit <= 0 {
+		return 0, nil
+	}
+
+	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.WarmListCache")
+	defer span.End()
+
+	if s.config.ListCacheWarmTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.ListCacheWarmTimeout)
+		defer cancel()
+	}
+
+	warmed := 0
+	for page := 1; page <= s.config.ListCacheWarmPages; page++ {
+		_, total, err := s.ListUsers(ctx, page, limit)
+		if err != nil {
+			tracing.RecordError(span, err)
+			tracing.AddSpanAttributes(span, attribute.Int("cache.pages_warmed", warmed))
+			return warmed, err
+		}
+		warmed++
+		if page*limit >= total {
+			break
+		}
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("cache.pages_warmed", warmed),
+		attribute.String("operation.result", "success"),
+	)
+	return warmed, nil
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"user-api/models"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ParseMinimumAges parses per-country minimum ages from a comma-separated
+// list of COUNTRY=AGE pairs, e.g. "US=13,DE=16". Countries are matched
+// case-insensitively against the address country.
+func ParseMinimumAges(data string) (map[string]int, error) {
+	ages := make(map[string]int)
+	for _, pair := range strings.Split(data, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		country, value, ok := strings.Cut(pair, "=")
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if !ok || country == "" {
+			return nil, fmt.Errorf("minimum age %q must be in COUNTRY=AGE form", pair)
+		}
+		age, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || age < 0 {
+			return nil, fmt.Errorf("minimum age for %s must be a non-negative integer", country)
+		}
+		ages[country] = age
+	}
+	return ages, nil
+}
+
+// minimumAgeEnabled reports whether any minimum signup age is configured
+func (c UserServiceConfig) minimumAgeEnabled() bool {
+	return c.MinimumAge > 0 || len(c.MinimumAgeByCountry) > 0
+}
+
+// minimumAgeFor returns the minimum signup age for the given address country,
+// falling back to the global default when the country has no rule
+func (c UserServiceConfig) minimumAgeFor(country string) int {
+	if age, ok := c.MinimumAgeByCountry[strings.ToUpper(strings.TrimSpace(country))]; ok {
+		return age
+	}
+	return c.MinimumAge
+}
+
+// validateMinimumAge reports a date of birth younger than the minimum age for
+// the request's address country. Missing or malformed dates are left to the
+// field validators.
+func (s *UserService) validateMinimumAge(sl validator.StructLevel, req models.CreateUserRequest) {
+	if req.DateOfBirth == "" {
+		return
+	}
+	dob, err := time.Parse("2006-01-02", req.DateOfBirth)
+	if err != nil {
+		return
+	}
+
+	country := ""
+	if req.Address != nil {
+		country = req.Address.Country
+	}
+	minimum := s.config.minimumAgeFor(country)
+	if minimum <= 0 {
+		return
+	}
+
+	// Compare calendar dates so users become eligible on their birthday
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if dob.AddDate(minimum, 0, 0).After(today) {
+		sl.ReportError(req.DateOfBirth, "DateOfBirth", "DateOfBirth", "min_age", strconv.Itoa(minimum))
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"strings"
+	"user-api/models"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// NormalizationConfig controls how create requests are cleaned before validation.
+// The zero value trims string fields and applies nothing else.
+type NormalizationConfig struct {
+	DisableTrim        bool // keep surrounding whitespace on string fields
+	CollapseWhitespace bool // collapse internal runs of whitespace in names
+	TitleCaseNames     bool // title-case first and last names
+	LowercaseEmail     bool // lowercase the email address
+}
+
+// DefaultNormalizationConfig returns the normalization applied when none is configured
+func DefaultNormalizationConfig() NormalizationConfig {
+	return NormalizationConfig{}
+}
+
+// normalizeRequest applies the configured normalization to the request's string fields
+// and describes each change it made
+func (s *UserService) normalizeRequest(req *models.CreateUserRequest) []string {
+	var transformations []string
+	req.FirstName = s.normalizeName("first_name", req.FirstName, &transformations)
+	req.LastName = s.normalizeName("last_name", req.LastName, &transformations)
+	req.Email = s.normalizeEmailField(req.Email, &transformations)
+	if !s.config.Normalization.DisableTrim {
+		req.Phone = applyTransformation("phone", "was trimmed", req.Phone, strings.TrimSpace, &transformations)
+		req.DateOfBirth = applyTransformation("date_of_birth", "was trimmed", req.DateOfBirth, strings.TrimSpace, &transformations)
+		req.Locale = applyTransformation("locale", "was trimmed", req.Locale, strings.TrimSpace, &transformations)
+	}
+	return transformations
+}
+
+// normalizeName applies trimming, whitespace collapsing and title-casing to a name
+func (s *UserService) normalizeName(field, name string, transformations *[]string) string {
+	config := s.config.Normalization
+	if !config.DisableTrim {
+		name = applyTransformation(field, "was trimmed", name, strings.TrimSpace, transformations)
+	}
+	if config.CollapseWhitespace {
+		name = applyTransformation(field, "whitespace was collapsed", name, func(v string) string {
+			return strings.Join(strings.Fields(v), " ")
+		}, transformations)
+	}
+	if config.TitleCaseNames {
+		// A Caser is stateful, so create one per call
+		name = applyTransformation(field, "was title-cased", name, cases.Title(language.Und).String, transformations)
+	}
+	return name
+}
+
+// normalizeEmail applies trimming and lowercasing to an email address
+func (s *UserService) normalizeEmail(email string) string {
+	return s.normalizeEmailField(email, nil)
+}
+
+// normalizeEmailField normalizes an email address, describing each change
+func (s *UserService) normalizeEmailField(email string, transformations *[]string) string {
+	if !s.config.Normalization.DisableTrim {
+		email = applyTransformation("email", "was trimmed", email, strings.TrimSpace, transformations)
+	}
+	if s.config.Normalization.LowercaseEmail {
+		email = applyTransformation("email", "was lowercased", email, strings.ToLower, transformations)
+	}
+	return email
+}
+
+// applyTransformation applies fn to value, recording "<field> <description>" when it changes
+// the value and transformations is non-nil
+func applyTransformation(field, description, value string, fn func(string) string, transformations *[]string) string {
+	result := fn(value)
+	if result != value && transformations != nil {
+		*transformations = append(*transformations, field+" "+description)
+	}
+	return result
+}
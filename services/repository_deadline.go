@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"user-api/models"
+	"user-api/repository"
+	"user-api/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrRepositoryTimeout is returned when a repository call exceeds its sub-deadline
+var ErrRepositoryTimeout = errors.New("repository call timed out")
+
+// deadlineRepository wraps a repository so every call runs under a sub-deadline:
+// budgetFraction of the request's remaining budget, capped at timeout
+type deadlineRepository struct {
+	repository.UserRepository
+	timeout        time.Duration
+	budgetFraction float64
+}
+
+// newDeadlineRepository wraps repo when a timeout or budget fraction is configured
+func newDeadlineRepository(repo repository.UserRepository, timeout time.Duration, budgetFraction float64) repository.UserRepository {
+	if timeout <= 0 && budgetFraction <= 0 {
+		return repo
+	}
+	return &deadlineRepository{
+		UserRepository: repo,
+		timeout:        timeout,
+		budgetFraction: budgetFraction,
+	}
+}
+
+// deadline returns the sub-deadline budget for a call, or 0 when none applies
+func (r *deadlineRepository) deadline(ctx context.Context) time.Duration {
+	budget := r.timeout
+	if requestDeadline, ok := ctx.Deadline(); ok && r.budgetFraction > 0 {
+		share := time.Duration(float64(time.Until(requestDeadline)) * r.budgetFraction)
+		if budget <= 0 || share < budget {
+			budget = share
+		}
+	}
+	return budget
+}
+
+// call runs fn under the sub-deadline, converting a sub-deadline expiry into ErrRepositoryTimeout
+// and recording it on the caller's span. Expiry of the request itself is returned unchanged.
+func (r *deadlineRepository) call(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	budget := r.deadline(ctx)
+	if budget <= 0 {
+		return fn(ctx)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+
+	err := fn(callCtx)
+	if err == nil || ctx.Err() != nil || !errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+
+	span := trace.SpanFromContext(ctx)
+	tracing.AddSpanAttributes(span,
+		tracing.AttrErrorType.String("repository_timeout"),
+		attribute.Int64("repository.deadline_ms", budget.Milliseconds()),
+	)
+	tracing.AddSpanEvent(span, "repository.timeout",
+		tracing.AttrDBOperation.String(operation),
+	)
+	return fmt.Errorf("%w: %s after %s", ErrRepositoryTimeout, operation, budget)
+}
+
+// Create adds a user under the sub-deadline
+func (r *deadlineRepository) Create(ctx context.Context, user *models.User) error {
+	return r.call(ctx, "create", func(ctx context.Context) error {
+		return r.UserRepository.Create(ctx, user)
+	})
+}
+
+// GetByID retrieves a user by ID under the sub-deadline
+func (r *deadlineRepository) GetByID(ctx context.Context, id string) (user *models.User, err error) {
+	err = r.call(ctx, "get_by_id", func(ctx context.Context) error {
+		user, err = r.UserRepository.GetByID(ctx, id)
+		return err
+	})
+	return user, err
+}
+
+// GetByEmail retrieves a user by email under the sub-deadline
+func (r *deadlineRepository) GetByEmail(ctx context.Context, email string) (user *models.User, err error) {
+	err = r.call(ctx, "get_by_email", func(ctx context.Context) error {
+		user, err = r.UserRepository.GetByEmail(ctx, email)
+		return err
+	})
+	return user, err
+}
+
+// GetAll retrieves all users under the sub-deadline
+func (r *deadlineRepository) GetAll(ctx context.Context) (users []*models.User, err error) {
+	err = r.call(ctx, "get_all", func(ctx context.Context) error {
+		users, err = r.UserRepository.GetAll(ctx)
+		return err
+	})
+	return users, err
+}
+
+// GetAllIDs retrieves all user IDs under the sub-deadline
+func (r *deadlineRepository) GetAllIDs(ctx context.Context) (ids []string, err error) {
+	err = r.call(ctx, "get_all_ids", func(ctx context.Context) error {
+		ids, err = r.UserRepository.GetAllIDs(ctx)
+		return err
+	})
+	return ids, err
+}
+
+// ListPage retrieves a page of users under the sub-deadline
+func (r *deadlineRepository) ListPage(ctx context.Context, offset, limit int) (users []*models.User, total int, err error) {
+	err = r.call(ctx, "list_page", func(ctx context.Context) error {
+		users, total, err = r.UserRepository.ListPage(ctx, offset, limit)
+		return err
+	})
+	return users, total, err
+}
+
+// ChangedSince retrieves recently updated users under the sub-deadline
+func (r *deadlineRepository) ChangedSince(ctx context.Context, since time.Time) (users []*models.User, err error) {
+	err = r.call(ctx, "changed_since", func(ctx context.Context) error {
+		users, err = r.UserRepository.ChangedSince(ctx, since)
+		return err
+	})
+	return users, err
+}
+
+// Update updates a user under the sub-deadline
+func (r *deadlineRepository) Update(ctx context.Context, user *models.User) error {
+	return r.call(ctx, "update", func(ctx context.Context) error {
+		return r.UserRepository.Update(ctx, user)
+	})
+}
+
+// Upsert creates or updates a user under the sub-deadline
+func (r *deadlineRepository) Upsert(ctx context.Context, user *models.User) (created bool, err error) {
+	err = r.call(ctx, "upsert", func(ctx context.Context) error {
+		created, err = r.UserRepository.Upsert(ctx, user)
+		return err
+	})
+	return created, err
+}
+
+// GetOrCreate finds or stores a user under the sub-deadline
+func (r *deadlineRepository) GetOrCreate(ctx context.Context, user *models.User) (stored *models.User, created bool, err error) {
+	err = r.call(ctx, "get_or_create", func(ctx context.Context) error {
+		stored, created, err = r.UserRepository.GetOrCreate(ctx, user)
+		return err
+	})
+	return stored, created, err
+}
+
+// Delete removes a user under the sub-deadline
+func (r *deadlineRepository) Delete(ctx context.Context, id string) error {
+	return r.call(ctx, "delete", func(ctx context.Context) error {
+		return r.UserRepository.Delete(ctx, id)
+	})
+}
+
+// Stats reports repository statistics under the sub-deadline
+func (r *deadlineRepository) Stats(ctx context.Context) (stats repository.RepoStats, err error) {
+	err = r.call(ctx, "stats", func(ctx context.Context) error {
+		stats, err = r.UserRepository.Stats(ctx)
+		return err
+	})
+	return stats, err
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"time"
+	"user-api/models"
+	"user-api/tracing"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// selfTestCleanupTimeout bounds the cleanup of a self-test user after a failed delete step
+const selfTestCleanupTimeout = 5 * time.Second
+
+// Self-test step names, in the order they run
+const (
+	SelfTestStepCreate = "create"
+	SelfTestStepRead   = "read"
+	SelfTestStepUpdate = "update"
+	SelfTestStepDelete = "delete"
+)
+
+// RunSelfTest creates a throwaway user, reads it back, updates it, and deletes it through
+// the service, recording each step's outcome and timing. Steps after a failure are skipped,
+// and the user is removed even when the run fails partway.
+func (s *UserService) RunSelfTest(ctx context.Context) models.SelfTestReport {
+	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.RunSelfTest")
+	defer span.End()
+
+	req := models.CreateUserRequest{
+		FirstName: "Selftest",
+		LastName:  "User",
+		Email:     s.selfTestEmail(),
+		Address:   &models.Address{City: "Selftest", Country: "US"},
+	}
+	report := models.SelfTestReport{Success: true, Email: req.Email}
+
+	run := func(name string, step func() error) bool {
+		if !report.Success {
+			return false
+		}
+		start := time.Now()
+		err := step()
+		result := models.SelfTestStep{
+			Name:       name,
+			Success:    err == nil,
+			DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if err != nil {
+			result.Error = err.Error()
+			report.Success = false
+			tracing.RecordError(span, err)
+		}
+		report.Steps = append(report.Steps, result)
+		return err == nil
+	}
+
+	var id string
+	run(SelfTestStepCreate, func() error {
+		user, err := s.CreateUser(ctx, req)
+		if err == nil {
+			id = user.ID
+		}
+		return err
+	})
+	run(SelfTestStepRead, func() error {
+		_, err := s.GetUserByID(ctx, id)
+		return err
+	})
+	run(SelfTestStepUpdate, func() error {
+		req.LastName = "Updated"
+		_, err := s.UpdateUser(ctx, id, models.UpdateUserRequest(req))
+		return err
+	})
+	deleted := run(SelfTestStepDelete, func() error {
+		return s.DeleteUser(ctx, id)
+	})
+	report.CleanedUp = id == "" || deleted
+
+	// Never leave the throwaway user behind, even if the request was cancelled
+	if !report.CleanedUp {
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), selfTestCleanupTimeout)
+		defer cancel()
+		if err := s.DeleteUser(cleanupCtx, id); err != nil {
+			tracing.RecordError(span, err)
+		} else {
+			report.CleanedUp = true
+		}
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Bool("selftest.success", report.Success),
+		attribute.Bool("selftest.cleaned_up", report.CleanedUp),
+		attribute.Int("selftest.steps", len(report.Steps)),
+	)
+	return report
+}
+
+// selfTestEmail returns a unique, clearly marked email for a self-test user,
+// using the first allowed domain when the domain allowlist is enabled
+func (s *UserService) selfTestEmail() string {
+	domain := "selftest.example.com"
+	if len(s.config.AllowedEmailDomains) > 0 {
+		domain = s.config.AllowedEmailDomains[0]
+	}
+	return "selftest-" + uuid.New().String() + "@" + domain
+}
@@ -3,6 +3,14 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 	"user-api/models"
 	"user-api/repository"
 	"user-api/tracing"
@@ -12,27 +20,366 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
+// UserServiceConfig holds user service configuration
+type UserServiceConfig struct {
+	AllowedEmailDomains []string // empty allows all domains
+	ValidationRules     []ValidationRule
+	ListCacheTTL        time.Duration // 0 disables list caching
+	MaxGetAllUsers      int           // GetAllUsers and FindDuplicates fail above this many users; 0 disables the cap
+	DuplicateScanLimit  int           // FindDuplicates fails above this many users; 0 disables the cap
+	// ListCacheWarmPages is the number of leading list pages preloaded at startup;
+	// ListCacheWarmTimeout bounds how long warming may take.
+	ListCacheWarmPages   int
+	ListCacheWarmTimeout time.Duration
+	Geocoder             Geocoder      // nil uses NoopGeocoder
+	StrictEmail          bool          // additionally require emails to parse with net/mail
+	DomainCreateLimit    int           // max creations per email domain per window; 0 disables
+	DomainCreateWindow   time.Duration // window for DomainCreateLimit
+	Normalization        NormalizationConfig
+	EchoTransformations  bool // include applied normalizations in create responses
+	RequireAddress       bool // require an address with a country on create
+	// MinimumAge is the minimum signup age derived from date_of_birth; MinimumAgeByCountry
+	// overrides it by address country. 0 and empty disable the check.
+	MinimumAge          int
+	MinimumAgeByCountry map[string]int
+	// RepositoryTimeout caps each repository call; RepositoryBudgetFraction limits it to a
+	// share of the request's remaining deadline. Exceeding either returns ErrRepositoryTimeout.
+	RepositoryTimeout        time.Duration
+	RepositoryBudgetFraction float64
+}
+
+// ValidationError represents a request that failed validation
+type ValidationError struct {
+	Message string
+	Fields  []models.FieldError
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
 // UserService handles business logic for user operations
 type UserService struct {
 	repo      repository.UserRepository
 	validator *validator.Validate
 	tracer    trace.Tracer
+	config    UserServiceConfig
+	rules     []compiledRule
+	listCache *listCache
+	limiter   *domainLimiter
+	integrity repository.IntegrityChecker // nil when the repository can't self-check
+
+	validationFailures *validationFailureCounter
+	events             *EventBroker
 }
 
-// NewUserService creates a new user service
+// NewUserService creates a new user service with the default configuration
 func NewUserService(repo repository.UserRepository) *UserService {
-	return &UserService{
-		repo:      repo,
+	s, _ := NewUserServiceWithConfig(repo, UserServiceConfig{
+		Normalization: DefaultNormalizationConfig(),
+	})
+	return s
+}
+
+// NewUserServiceWithConfig creates a new user service with the given configuration.
+// It returns an error if any custom validation rule is invalid.
+func NewUserServiceWithConfig(repo repository.UserRepository, config UserServiceConfig) (*UserService, error) {
+	rules, err := compileValidationRules(config.ValidationRules)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Geocoder == nil {
+		config.Geocoder = NoopGeocoder{}
+	}
+
+	s := &UserService{
+		repo:      newDeadlineRepository(repo, config.RepositoryTimeout, config.RepositoryBudgetFraction),
 		validator: validator.New(),
 		tracer:    tracing.GetTracer("user-api/services"),
+		config:    config,
+		rules:     rules,
+		listCache: newListCache(config.ListCacheTTL),
+		limiter:   newDomainLimiter(config.DomainCreateLimit, config.DomainCreateWindow),
+
+		validationFailures: newValidationFailureCounter(),
+		events:             NewEventBroker(),
+	}
+	if checker, ok := repo.(repository.IntegrityChecker); ok {
+		s.integrity = checker
+	}
+	s.validator.RegisterValidation("email_domain", s.validateEmailDomain)
+	s.validator.RegisterValidation("strict_email", s.validateStrictEmail)
+	if config.RequireAddress || config.minimumAgeEnabled() {
+		s.validator.RegisterStructValidation(s.validateCreateRequest, models.CreateUserRequest{})
+	}
+	if config.RequireAddress {
+		s.validator.RegisterStructValidation(validateAddressCountry, models.Address{})
+	}
+	return s, nil
+}
+
+// LoadUserServiceConfigFromEnv loads user service configuration from environment variables.
+// Settings that would weaken validation if ignored, such as the validation rules and
+// minimum ages, return an error when invalid instead of falling back.
+func LoadUserServiceConfigFromEnv() (UserServiceConfig, error) {
+	config := UserServiceConfig{
+		Normalization: DefaultNormalizationConfig(),
+	}
+
+	// Parse allowed email domains
+	for _, domain := range strings.Split(os.Getenv("EMAIL_ALLOWED_DOMAINS"), ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			config.AllowedEmailDomains = append(config.AllowedEmailDomains, domain)
+		}
+	}
+
+	// Parse custom validation rules
+	rules, err := ParseValidationRules(os.Getenv("VALIDATION_RULES"))
+	if err != nil {
+		return UserServiceConfig{}, fmt.Errorf("invalid VALIDATION_RULES: %w", err)
+	}
+	config.ValidationRules = rules
+
+	// Parse list cache TTL
+	if ttl := os.Getenv("LIST_CACHE_TTL"); ttl != "" {
+		if d, err := time.ParseDuration(ttl); err == nil {
+			config.ListCacheTTL = d
+		} else {
+			log.Printf("Invalid LIST_CACHE_TTL %q, list caching disabled", ttl)
+		}
+	}
+	// Parse the GetAllUsers cap
+	config.MaxGetAllUsers = DefaultMaxGetAllUsers
+	if value := os.Getenv("MAX_GET_ALL_USERS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			config.MaxGetAllUsers = n
+		} else {
+			log.Printf("Invalid MAX_GET_ALL_USERS %q, using %d", value, config.MaxGetAllUsers)
+		}
+	}
+
+	// Parse the duplicate scan cap
+	config.DuplicateScanLimit = DefaultDuplicateScanLimit
+	if value := os.Getenv("DUPLICATES_MAX_USERS"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			config.DuplicateScanLimit = n
+		} else {
+			log.Printf("Invalid DUPLICATES_MAX_USERS %q, using %d", value, config.DuplicateScanLimit)
+		}
+	}
+
+	// Parse list cache warming
+	config.ListCacheWarmTimeout = 5 * time.Second
+	if pages := os.Getenv("LIST_CACHE_WARM_PAGES"); pages != "" {
+		if n, err := strconv.Atoi(pages); err == nil && n >= 0 {
+			config.ListCacheWarmPages = n
+		} else {
+			log.Printf("Invalid LIST_CACHE_WARM_PAGES %q, cache warming disabled", pages)
+		}
+	}
+	if timeout := os.Getenv("LIST_CACHE_WARM_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil && d > 0 {
+			config.ListCacheWarmTimeout = d
+		} else {
+			log.Printf("Invalid LIST_CACHE_WARM_TIMEOUT %q, using %s", timeout, config.ListCacheWarmTimeout)
+		}
+	}
+
+	// Parse per-domain creation limit
+	if limit, err := strconv.Atoi(os.Getenv("DOMAIN_CREATE_LIMIT")); err == nil && limit > 0 {
+		config.DomainCreateLimit = limit
+		config.DomainCreateWindow = time.Hour
+		if window := os.Getenv("DOMAIN_CREATE_WINDOW"); window != "" {
+			if d, err := time.ParseDuration(window); err == nil && d > 0 {
+				config.DomainCreateWindow = d
+			} else {
+				log.Printf("Invalid DOMAIN_CREATE_WINDOW %q, using %s", window, config.DomainCreateWindow)
+			}
+		}
+	}
+
+	// Parse repository call deadlines
+	if timeout := os.Getenv("REPOSITORY_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil && d > 0 {
+			config.RepositoryTimeout = d
+		} else {
+			log.Printf("Invalid REPOSITORY_TIMEOUT %q, repository timeout disabled", timeout)
+		}
+	}
+	if fraction := os.Getenv("REPOSITORY_BUDGET_FRACTION"); fraction != "" {
+		if f, err := strconv.ParseFloat(fraction, 64); err == nil && f > 0 && f <= 1 {
+			config.RepositoryBudgetFraction = f
+		} else {
+			log.Printf("Invalid REPOSITORY_BUDGET_FRACTION %q, must be in (0, 1]", fraction)
+		}
+	}
+
+	// Parse normalization flags
+	config.Normalization.DisableTrim = !parseBoolEnv("NORMALIZE_TRIM", !config.Normalization.DisableTrim)
+	config.Normalization.CollapseWhitespace = parseBoolEnv("NORMALIZE_COLLAPSE_WHITESPACE", config.Normalization.CollapseWhitespace)
+	config.Normalization.TitleCaseNames = parseBoolEnv("NORMALIZE_TITLE_CASE_NAMES", config.Normalization.TitleCaseNames)
+	config.Normalization.LowercaseEmail = parseBoolEnv("NORMALIZE_LOWERCASE_EMAIL", config.Normalization.LowercaseEmail)
+
+	config.EchoTransformations = parseBoolEnv("ECHO_TRANSFORMATIONS", false)
+	config.RequireAddress = parseBoolEnv("REQUIRE_ADDRESS", false)
+
+	// Parse minimum signup ages
+	if age := os.Getenv("MINIMUM_AGE"); age != "" {
+		n, err := strconv.Atoi(age)
+		if err != nil || n < 0 {
+			return UserServiceConfig{}, fmt.Errorf("invalid MINIMUM_AGE %q: must be a non-negative number of years", age)
+		}
+		config.MinimumAge = n
+	}
+	ages, err := ParseMinimumAges(os.Getenv("MINIMUM_AGE_BY_COUNTRY"))
+	if err != nil {
+		return UserServiceConfig{}, fmt.Errorf("invalid MINIMUM_AGE_BY_COUNTRY: %w", err)
+	}
+	if len(ages) > 0 {
+		config.MinimumAgeByCountry = ages
+	}
+
+	// Parse strict email validation toggle
+	if strict := os.Getenv("EMAIL_STRICT_VALIDATION"); strict != "" {
+		enabled, err := strconv.ParseBool(strict)
+		if err != nil {
+			return UserServiceConfig{}, fmt.Errorf("invalid EMAIL_STRICT_VALIDATION %q: must be a boolean", strict)
+		}
+		config.StrictEmail = enabled
+	}
+
+	return config, nil
+}
+
+// parseBoolEnv parses a boolean environment variable, keeping the default if unset or
+// invalid and logging invalid values
+func parseBoolEnv(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid value for %s: %q, using default %t", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// validateRequest validates a create request against struct tags and custom rules,
+// recording any failure reasons on the span
+func (s *UserService) validateRequest(span trace.Span, req models.CreateUserRequest) error {
+	err := s.checkRequest(req)
+	if err != nil {
+		s.recordValidationFailure(span, err)
+	}
+	return err
+}
+
+// validateBatchItem validates one request of a batch, recording any failure reasons as
+// an event on the batch span rather than overwriting its attributes
+func (s *UserService) validateBatchItem(span trace.Span, index int, req models.CreateUserRequest) error {
+	err := s.checkRequest(req)
+	if err != nil {
+		s.recordItemValidationFailure(span, index, err)
+	}
+	return err
+}
+
+// checkRequest validates a create request against struct tags and custom rules
+func (s *UserService) checkRequest(req models.CreateUserRequest) error {
+	if err := s.validator.Struct(req); err != nil {
+		return s.formatValidationError(err)
+	}
+	return s.checkValidationRules(req)
+}
+
+// validateEmailDomain checks the email's domain against the configured allowlist
+func (s *UserService) validateEmailDomain(fl validator.FieldLevel) bool {
+	if len(s.config.AllowedEmailDomains) == 0 {
+		return true
+	}
+
+	email := fl.Field().String()
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range s.config.AllowedEmailDomains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// validateStrictEmail requires the email to parse with net/mail as a bare
+// address, rejecting display names and comments
+func (s *UserService) validateStrictEmail(fl validator.FieldLevel) bool {
+	if !s.config.StrictEmail {
+		return true
+	}
+
+	email := fl.Field().String()
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return false
+	}
+	return addr.Name == "" && addr.Address == email
+}
+
+// EchoTransformations reports whether create responses should always list applied normalizations
+func (s *UserService) EchoTransformations() bool {
+	return s.config.EchoTransformations
+}
+
+// validateCreateRequest runs the configured cross-field checks on a create request
+func (s *UserService) validateCreateRequest(sl validator.StructLevel) {
+	if s.config.RequireAddress {
+		validateRequiredAddress(sl)
+	}
+	if s.config.minimumAgeEnabled() {
+		s.validateMinimumAge(sl, sl.Current().Interface().(models.CreateUserRequest))
+	}
+}
+
+// validateRequiredAddress reports a missing address on a create request
+func validateRequiredAddress(sl validator.StructLevel) {
+	req := sl.Current().Interface().(models.CreateUserRequest)
+	if req.Address == nil {
+		sl.ReportError(req.Address, "Address", "Address", "required", "")
+	}
+}
+
+// validateAddressCountry reports an address without a country
+func validateAddressCountry(sl validator.StructLevel) {
+	address := sl.Current().Interface().(models.Address)
+	if strings.TrimSpace(address.Country) == "" {
+		sl.ReportError(address.Country, "Country", "Country", "required", "")
 	}
 }
 
 // CreateUser creates a new user
 func (s *UserService) CreateUser(ctx context.Context, req models.CreateUserRequest) (*models.User, error) {
+	user, _, err := s.CreateUserWithTransformations(ctx, req)
+	return user, err
+}
+
+// CreateUserWithTransformations creates a new user and describes the normalizations
+// applied to the request, e.g. "email was lowercased"
+func (s *UserService) CreateUserWithTransformations(ctx context.Context, req models.CreateUserRequest) (*models.User, []string, error) {
 	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.CreateUser")
 	defer span.End()
 
+	transformations := s.normalizeRequest(&req)
+	if len(transformations) > 0 {
+		tracing.AddSpanAttributes(span, attribute.StringSlice("request.transformations", transformations))
+	}
+
 	// Add request attributes
 	tracing.AddSpanAttributes(span,
 		tracing.AttrUserEmail.String(req.Email),
@@ -40,42 +387,344 @@ func (s *UserService) CreateUser(ctx context.Context, req models.CreateUserReque
 		attribute.String("user.last_name", req.LastName),
 	)
 
+	if err := checkContext(ctx, span); err != nil {
+		return nil, nil, err
+	}
+
 	// Validate the request
-	tracing.AddSpanEvent(span, "validation.start")
-	if err := s.validator.Struct(req); err != nil {
-		tracing.RecordError(span, err)
+	if err := tracing.TimedEvent(span, "validation", func() error {
+		return s.validateRequest(span, req)
+	}); err != nil {
 		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
-		return nil, s.formatValidationError(err)
+		return nil, nil, err
 	}
-	tracing.AddSpanEvent(span, "validation.success")
 
-	// Check if user with email already exists
-	tracing.AddSpanEvent(span, "email_check.start")
-	if _, err := s.repo.GetByEmail(ctx, req.Email); err == nil {
-		err := errors.New("user with this email already exists")
-		tracing.RecordError(span, err)
+	// Fast path for known emails; the repository's Create enforces uniqueness atomically
+	if err := tracing.TimedEvent(span, "email_check", func() error {
+		if _, err := s.repo.GetByEmail(ctx, req.Email); err == nil {
+			return repository.ErrDuplicateEmail
+		}
+		return nil
+	}); err != nil {
 		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("duplicate_email"))
-		return nil, err
+		return nil, nil, err
+	}
+
+	// Throttle signups per email domain
+	if !s.limiter.allow(req.Email) {
+		err := ErrDomainRateLimited
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("rate_limited"))
+		return nil, nil, err
 	}
-	tracing.AddSpanEvent(span, "email_check.success")
+	// Give the slot back unless the user is actually stored
+	stored := false
+	defer func() {
+		if !stored {
+			s.limiter.release(req.Email)
+		}
+	}()
 
 	// Create new user
 	user := models.NewUser(req)
 	tracing.AddSpanAttributes(span, tracing.AttrUserID.String(user.ID))
 
+	// Enrich the address with coordinates; failures don't fail the request
+	s.geocodeAddress(ctx, user.Address)
+
+	// Stop before persisting if the client has gone away
+	if err := checkContext(ctx, span); err != nil {
+		return nil, nil, err
+	}
+
 	// Save to repository
 	tracing.AddSpanEvent(span, "repository.create.start")
 	if err := s.repo.Create(ctx, user); err != nil {
 		tracing.RecordError(span, err)
+		if errors.Is(err, repository.ErrDuplicateEmail) {
+			// Lost a race with a concurrent create for the same email
+			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("duplicate_email"))
+			return nil, nil, err
+		}
 		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("repository_error"))
-		return nil, err
+		return nil, nil, err
 	}
 	tracing.AddSpanEvent(span, "repository.create.success")
+	stored = true
+	s.listCache.invalidate()
+	s.publishUserEvent(models.UserEventCreated, user)
+
+	tracing.AddSpanAttributes(span, attribute.String("operation.result", "success"))
+	return user, transformations, nil
+}
+
+// GetOrCreate returns the user with the request's email, creating it when none exists.
+// It reports whether the user was created; concurrent calls create at most one user.
+func (s *UserService) GetOrCreate(ctx context.Context, req models.CreateUserRequest) (*models.User, bool, error) {
+	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.GetOrCreate")
+	defer span.End()
+
+	s.normalizeRequest(&req)
+	tracing.AddSpanAttributes(span, tracing.AttrUserEmail.String(req.Email))
+
+	if err := checkContext(ctx, span); err != nil {
+		return nil, false, err
+	}
+
+	if err := tracing.TimedEvent(span, "validation", func() error {
+		return s.validateRequest(span, req)
+	}); err != nil {
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
+		return nil, false, err
+	}
+
+	// Fast path: existing users don't count against the domain limit
+	if existing, err := s.repo.GetByEmail(ctx, req.Email); err == nil {
+		tracing.AddSpanAttributes(span,
+			tracing.AttrUserID.String(existing.ID),
+			attribute.Bool("user.created", false),
+			attribute.String("operation.result", "success"),
+		)
+		return existing, false, nil
+	}
+
+	if !s.limiter.allow(req.Email) {
+		err := ErrDomainRateLimited
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("rate_limited"))
+		return nil, false, err
+	}
+	// Give the slot back unless this call stored the user
+	created := false
+	defer func() {
+		if !created {
+			s.limiter.release(req.Email)
+		}
+	}()
+
+	user := models.NewUser(req)
+	s.geocodeAddress(ctx, user.Address)
+
+	if err := checkContext(ctx, span); err != nil {
+		return nil, false, err
+	}
+
+	// The repository settles races between concurrent callers
+	var err error
+	user, created, err = s.repo.GetOrCreate(ctx, user)
+	if err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("repository_error"))
+		return nil, false, err
+	}
+	if created {
+		s.listCache.invalidate()
+		s.publishUserEvent(models.UserEventCreated, user)
+	}
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrUserID.String(user.ID),
+		attribute.Bool("user.created", created),
+		attribute.String("operation.result", "success"),
+	)
+	return user, created, nil
+}
+
+// geocodeAddress sets the address coordinates using the configured geocoder
+func (s *UserService) geocodeAddress(ctx context.Context, address *models.Address) {
+	if address == nil {
+		return
+	}
+
+	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.geocodeAddress")
+	defer span.End()
+
+	lat, lng, err := s.config.Geocoder.Geocode(ctx, *address)
+	if errors.Is(err, ErrNoCoordinates) {
+		tracing.AddSpanAttributes(span, attribute.String("geocode.result", "not_found"))
+		return
+	}
+	if err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("geocode_error"))
+		return
+	}
+
+	address.Latitude = &lat
+	address.Longitude = &lng
+	tracing.AddSpanAttributes(span, attribute.String("geocode.result", "success"))
+}
+
+// BulkUpsertUsers creates or updates each user keyed by email and reports per-item results.
+// It stops and returns the context error if the context is cancelled between items.
+func (s *UserService) BulkUpsertUsers(ctx context.Context, reqs []models.CreateUserRequest) ([]models.BulkUpsertResult, error) {
+	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.BulkUpsertUsers")
+	defer span.End()
+
+	tracing.AddSpanAttributes(span, attribute.Int("bulk.size", len(reqs)))
+
+	results := make([]models.BulkUpsertResult, 0, len(reqs))
+	created, updated, failed := 0, 0, 0
+
+	for i, req := range reqs {
+		if err := checkContext(ctx, span); err != nil {
+			return nil, err
+		}
+
+		s.normalizeRequest(&req)
+		result := models.BulkUpsertResult{Index: i, Email: req.Email}
+
+		if err := s.validateBatchItem(span, i, req); err != nil {
+			result.Status = models.BulkStatusError
+			result.Error = err.Error()
+			results = append(results, result)
+			failed++
+			continue
+		}
+
+		// New emails count against the domain creation limit; updates don't
+		reserved := false
+		if s.limiter.enabled() {
+			if _, err := s.repo.GetByEmail(ctx, req.Email); err != nil {
+				if !s.limiter.allow(req.Email) {
+					tracing.AddSpanEvent(span, "bulk.item.rate_limited", attribute.Int("bulk.index", i))
+					result.Status = models.BulkStatusError
+					result.Error = ErrDomainRateLimited.Error()
+					results = append(results, result)
+					failed++
+					continue
+				}
+				reserved = true
+			}
+		}
+
+		user := models.NewUser(req)
+		s.geocodeAddress(ctx, user.Address)
+		isNew, err := s.repo.Upsert(ctx, user)
+		if reserved && (err != nil || !isNew) {
+			s.limiter.release(req.Email)
+		}
+		if err != nil {
+			result.Status = models.BulkStatusError
+			result.Error = err.Error()
+			results = append(results, result)
+			failed++
+			continue
+		}
+
+		s.listCache.invalidate()
+		if isNew {
+			result.Status = models.BulkStatusCreated
+			created++
+			s.publishUserEvent(models.UserEventCreated, user)
+		} else {
+			result.Status = models.BulkStatusUpdated
+			updated++
+			s.publishUserEvent(models.UserEventUpdated, user)
+		}
+		response := user.ToResponse()
+		result.User = &response
+		results = append(results, result)
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("bulk.created", created),
+		attribute.Int("bulk.updated", updated),
+		attribute.Int("bulk.failed", failed),
+	)
+
+	return results, nil
+}
+
+// UpdateUser replaces the editable fields of the user with the given ID, keeping its
+// ID and creation time and bumping UpdatedAt
+func (s *UserService) UpdateUser(ctx context.Context, id string, req models.UpdateUserRequest) (*models.User, error) {
+	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.UpdateUser")
+	defer span.End()
+
+	createReq := models.CreateUserRequest(req)
+	s.normalizeRequest(&createReq)
+
+	tracing.AddSpanAttributes(span,
+		tracing.AttrUserID.String(id),
+		tracing.AttrUserEmail.String(createReq.Email),
+	)
+
+	if err := checkContext(ctx, span); err != nil {
+		return nil, err
+	}
+
+	if err := tracing.TimedEvent(span, "validation", func() error {
+		return s.validateRequest(span, createReq)
+	}); err != nil {
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("validation_error"))
+		return nil, err
+	}
+
+	existing, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("repository_error"))
+		return nil, err
+	}
+
+	// Build a new record rather than mutating the stored one
+	user := models.NewUser(createReq)
+	user.ID = existing.ID
+	user.CreatedAt = existing.CreatedAt
+	s.geocodeAddress(ctx, user.Address)
+
+	if err := checkContext(ctx, span); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Update(ctx, user); err != nil {
+		tracing.RecordError(span, err)
+		if errors.Is(err, repository.ErrDuplicateEmail) {
+			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("duplicate_email"))
+			return nil, err
+		}
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("repository_error"))
+		return nil, err
+	}
+	s.listCache.invalidate()
+	s.publishUserEvent(models.UserEventUpdated, user)
 
 	tracing.AddSpanAttributes(span, attribute.String("operation.result", "success"))
 	return user, nil
 }
 
+// DeleteUser removes a user by ID
+func (s *UserService) DeleteUser(ctx context.Context, id string) error {
+	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.DeleteUser")
+	defer span.End()
+
+	tracing.AddSpanAttributes(span, tracing.AttrUserID.String(id))
+
+	if err := checkContext(ctx, span); err != nil {
+		return err
+	}
+
+	// Read the user first so the deleted event can carry it
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("repository_error"))
+		return err
+	}
+
+	if err := s.repo.Delete(ctx, id); err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("repository_error"))
+		return err
+	}
+	s.listCache.invalidate()
+	s.publishUserEvent(models.UserEventDeleted, user)
+
+	tracing.AddSpanAttributes(span, attribute.String("operation.result", "success"))
+	return nil
+}
+
 // GetUserByID retrieves a user by ID
 func (s *UserService) GetUserByID(ctx context.Context, id string) (*models.User, error) {
 	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.GetUserByID")
@@ -83,6 +732,10 @@ func (s *UserService) GetUserByID(ctx context.Context, id string) (*models.User,
 
 	tracing.AddSpanAttributes(span, tracing.AttrUserID.String(id))
 
+	if err := checkContext(ctx, span); err != nil {
+		return nil, err
+	}
+
 	if id == "" {
 		err := errors.New("user ID is required")
 		tracing.RecordError(span, err)
@@ -110,8 +763,14 @@ func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*models
 	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.GetUserByEmail")
 	defer span.End()
 
+	email = s.normalizeEmail(email)
+
 	tracing.AddSpanAttributes(span, tracing.AttrUserEmail.String(email))
 
+	if err := checkContext(ctx, span); err != nil {
+		return nil, err
+	}
+
 	if email == "" {
 		err := errors.New("email is required")
 		tracing.RecordError(span, err)
@@ -134,11 +793,42 @@ func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*models
 	return user, nil
 }
 
-// GetAllUsers retrieves all users
+// ErrTooManyUsers is returned by GetAllUsers when the dataset exceeds MaxGetAllUsers
+var ErrTooManyUsers = errors.New("too many users to return at once, use ListUsers to paginate")
+
+// DefaultMaxGetAllUsers is the default cap on users returned by GetAllUsers
+const DefaultMaxGetAllUsers = 1000
+
+// GetAllUsers retrieves all users. It returns ErrTooManyUsers rather than an unbounded
+// result when there are more than MaxGetAllUsers.
 func (s *UserService) GetAllUsers(ctx context.Context) ([]*models.User, error) {
 	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.GetAllUsers")
 	defer span.End()
 
+	if err := checkContext(ctx, span); err != nil {
+		return nil, err
+	}
+
+	// Check the size before loading anything
+	if limit := s.config.MaxGetAllUsers; limit > 0 {
+		stats, err := s.repo.Stats(ctx)
+		if err != nil {
+			tracing.RecordError(span, err)
+			tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("repository_error"))
+			return nil, err
+		}
+		if stats.UserCount > limit {
+			err := fmt.Errorf("%w (%d users exceed the limit of %d)", ErrTooManyUsers, stats.UserCount, limit)
+			tracing.RecordError(span, err)
+			tracing.AddSpanAttributes(span,
+				tracing.AttrErrorType.String("too_many_users"),
+				attribute.Int("users.count", stats.UserCount),
+				attribute.Int("users.limit", limit),
+			)
+			return nil, err
+		}
+	}
+
 	users, err := s.repo.GetAll(ctx)
 	if err != nil {
 		tracing.RecordError(span, err)
@@ -154,25 +844,286 @@ func (s *UserService) GetAllUsers(ctx context.Context) ([]*models.User, error) {
 	return users, nil
 }
 
+// ListUsers retrieves a page of users ordered by creation time, along with the total count
+func (s *UserService) ListUsers(ctx context.Context, page, limit int) ([]*models.User, int, error) {
+	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.ListUsers")
+	defer span.End()
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("pagination.page", page),
+		attribute.Int("pagination.limit", limit),
+	)
+
+	if err := checkContext(ctx, span); err != nil {
+		return nil, 0, err
+	}
+
+	if s.listCache.enabled() {
+		if users, total, ok := s.listCache.get(page, limit); ok {
+			tracing.AddSpanAttributes(span,
+				attribute.Bool("cache.hit", true),
+				attribute.Int("users.count", len(users)),
+				attribute.Int("users.total", total),
+				attribute.String("operation.result", "success"),
+			)
+			return users, total, nil
+		}
+		tracing.AddSpanAttributes(span, attribute.Bool("cache.hit", false))
+	}
+
+	// Capture the version before reading so a concurrent write keeps this page out of the cache
+	version := s.listCache.currentVersion()
+	pageUsers, total, err := s.repo.ListPage(ctx, (page-1)*limit, limit)
+	if err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("repository_error"))
+		return nil, 0, err
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("users.count", len(pageUsers)),
+		attribute.Int("users.total", total),
+		attribute.String("operation.result", "success"),
+	)
+
+	if s.listCache.enabled() {
+		s.listCache.set(page, limit, version, pageUsers, total)
+	}
+
+	return pageUsers, total, nil
+}
+
+// ListUserIDs retrieves a page of user IDs ordered by creation time, along with the total count
+func (s *UserService) ListUserIDs(ctx context.Context, page, limit int) ([]string, int, error) {
+	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.ListUserIDs")
+	defer span.End()
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("pagination.page", page),
+		attribute.Int("pagination.limit", limit),
+	)
+
+	if err := checkContext(ctx, span); err != nil {
+		return nil, 0, err
+	}
+
+	ids, err := s.repo.GetAllIDs(ctx)
+	if err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("repository_error"))
+		return nil, 0, err
+	}
+
+	total := len(ids)
+	start := (page - 1) * limit
+	if start > total {
+		start = total
+	}
+	end := start + limit
+	if end > total {
+		end = total
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("users.count", end-start),
+		attribute.Int("users.total", total),
+		attribute.String("operation.result", "success"),
+	)
+
+	return ids[start:end], total, nil
+}
+
+// ListUsersChangedSince returns a page of users updated at or after since, including
+// tombstones of users deleted since then, oldest change first
+func (s *UserService) ListUsersChangedSince(ctx context.Context, since time.Time, page, limit int) ([]*models.User, int, error) {
+	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.ListUsersChangedSince")
+	defer span.End()
+
+	tracing.AddSpanAttributes(span,
+		attribute.String("changed_since", since.Format(time.RFC3339Nano)),
+		attribute.Int("pagination.page", page),
+		attribute.Int("pagination.limit", limit),
+	)
+
+	if err := checkContext(ctx, span); err != nil {
+		return nil, 0, err
+	}
+
+	users, err := s.repo.ChangedSince(ctx, since)
+	if err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("repository_error"))
+		return nil, 0, err
+	}
+
+	total := len(users)
+	start := (page - 1) * limit
+	if start > total {
+		start = total
+	}
+	end := start + limit
+	if end > total {
+		end = total
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("users.count", end-start),
+		attribute.Int("users.total", total),
+		attribute.String("operation.result", "success"),
+	)
+
+	return users[start:end], total, nil
+}
+
+// ValidateUsers validates each request with the create rules, without uniqueness
+// checks or persistence, and reports per-item field errors
+func (s *UserService) ValidateUsers(ctx context.Context, reqs []models.CreateUserRequest) ([]models.ValidationResult, error) {
+	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.ValidateUsers")
+	defer span.End()
+
+	tracing.AddSpanAttributes(span, attribute.Int("batch.size", len(reqs)))
+
+	if err := checkContext(ctx, span); err != nil {
+		return nil, err
+	}
+
+	results := make([]models.ValidationResult, 0, len(reqs))
+	invalid := 0
+	for i, req := range reqs {
+		s.normalizeRequest(&req)
+		result := models.ValidationResult{Index: i, Valid: true}
+
+		if err := s.validateBatchItem(span, i, req); err != nil {
+			result.Valid = false
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				result.Errors = validationErr.Fields
+			}
+			if len(result.Errors) == 0 {
+				result.Errors = []models.FieldError{{Message: err.Error()}}
+			}
+			invalid++
+		}
+		results = append(results, result)
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("batch.invalid", invalid),
+		attribute.String("operation.result", "success"),
+	)
+	return results, nil
+}
+
+// GetRepositoryStats returns repository health and size information
+func (s *UserService) GetRepositoryStats(ctx context.Context) (repository.RepoStats, error) {
+	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.GetRepositoryStats")
+	defer span.End()
+
+	if err := checkContext(ctx, span); err != nil {
+		return repository.RepoStats{}, err
+	}
+
+	stats, err := s.repo.Stats(ctx)
+	if err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("repository_error"))
+		return repository.RepoStats{}, err
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.String("repository.backend", stats.Backend),
+		attribute.Int("users.count", stats.UserCount),
+		attribute.String("operation.result", "success"),
+	)
+	return stats, nil
+}
+
+// ErrIntegrityUnsupported is returned when the repository cannot verify its own integrity
+var ErrIntegrityUnsupported = errors.New("repository does not support integrity checks")
+
+// CheckIntegrity reports broken repository invariants, repairing what it can first when repair is set
+func (s *UserService) CheckIntegrity(ctx context.Context, repair bool) ([]string, error) {
+	ctx, span := tracing.StartSpan(ctx, s.tracer, "UserService.CheckIntegrity")
+	defer span.End()
+
+	tracing.AddSpanAttributes(span, attribute.Bool("integrity.repair", repair))
+
+	if s.integrity == nil {
+		tracing.RecordError(span, ErrIntegrityUnsupported)
+		return nil, ErrIntegrityUnsupported
+	}
+	if err := checkContext(ctx, span); err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	var err error
+	if repair {
+		problems, err = s.integrity.RepairIntegrity(ctx)
+		s.listCache.invalidate()
+	} else {
+		problems, err = s.integrity.VerifyIntegrity(ctx)
+	}
+	if err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("repository_error"))
+		return nil, err
+	}
+
+	tracing.AddSpanAttributes(span,
+		attribute.Int("integrity.problems", len(problems)),
+		attribute.String("operation.result", "success"),
+	)
+	return problems, nil
+}
+
+// checkContext returns the context error if the caller has gone away, recording it on the span
+func checkContext(ctx context.Context, span trace.Span) error {
+	if err := ctx.Err(); err != nil {
+		tracing.RecordError(span, err)
+		tracing.AddSpanAttributes(span, tracing.AttrErrorType.String("context_cancelled"))
+		tracing.AddSpanEvent(span, "context.cancelled")
+		return err
+	}
+	return nil
+}
+
 // formatValidationError formats validation errors into a readable message
+// along with per-field details
 func (s *UserService) formatValidationError(err error) error {
 	if validationErrors, ok := err.(validator.ValidationErrors); ok {
 		var errorMessages []string
+		var fields []models.FieldError
 		for _, fieldError := range validationErrors {
+			var message string
 			switch fieldError.Tag() {
 			case "required":
-				errorMessages = append(errorMessages, fieldError.Field()+" is required")
+				message = fieldError.Field() + " is required"
 			case "email":
-				errorMessages = append(errorMessages, fieldError.Field()+" must be a valid email address")
+				message = fieldError.Field() + " must be a valid email address"
 			case "min":
-				errorMessages = append(errorMessages, fieldError.Field()+" must be at least "+fieldError.Param()+" characters long")
+				message = fieldError.Field() + " must be at least " + fieldError.Param() + " characters long"
 			case "max":
-				errorMessages = append(errorMessages, fieldError.Field()+" must be at most "+fieldError.Param()+" characters long")
+				message = fieldError.Field() + " must be at most " + fieldError.Param() + " characters long"
 			case "datetime":
-				errorMessages = append(errorMessages, fieldError.Field()+" must be in YYYY-MM-DD format")
+				message = fieldError.Field() + " must be in YYYY-MM-DD format"
+			case "bcp47_language_tag":
+				message = fieldError.Field() + " must be a valid BCP 47 language tag"
+			case "strict_email":
+				message = fieldError.Field() + " must be a plain email address without display name or comments"
+			case "min_age":
+				message = fieldError.Field() + " must show an age of at least " + fieldError.Param() + " years"
+			case "email_domain":
+				message = fieldError.Field() + " must use an allowed domain (" + strings.Join(s.config.AllowedEmailDomains, ", ") + ")"
 			default:
-				errorMessages = append(errorMessages, fieldError.Field()+" is invalid")
+				message = fieldError.Field() + " is invalid"
 			}
+			errorMessages = append(errorMessages, message)
+			fields = append(fields, models.FieldError{
+				Field:   jsonFieldPath(fieldError.StructNamespace()),
+				Tag:     fieldError.Tag(),
+				Message: message,
+			})
 		}
 
 		// Join all error messages
@@ -183,8 +1134,32 @@ func (s *UserService) formatValidationError(err error) error {
 			}
 			combinedMessage += msg
 		}
-		return errors.New(combinedMessage)
+		return &ValidationError{Message: combinedMessage, Fields: fields}
 	}
 
 	return err
 }
+
+// jsonFieldPath converts a validator struct namespace such as
+// "CreateUserRequest.Address.City" into its JSON path, e.g. "address.city"
+func jsonFieldPath(namespace string) string {
+	parts := strings.Split(namespace, ".")
+	t := reflect.TypeOf(models.CreateUserRequest{})
+	var path []string
+	for _, part := range parts[1:] {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return namespace
+		}
+		field, ok := t.FieldByName(part)
+		if !ok {
+			return namespace
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		path = append(path, name)
+		t = field.Type
+	}
+	return strings.Join(path, ".")
+}
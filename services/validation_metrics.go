@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"user-api/models"
+	"user-api/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// otherLabel replaces unknown fields and tags so failure labels stay bounded
+const otherLabel = "other"
+
+// knownValidationTags are the validation tags failures are labeled with
+var knownValidationTags = map[string]bool{
+	"required":           true,
+	"email":              true,
+	"min":                true,
+	"max":                true,
+	"datetime":           true,
+	"bcp47_language_tag": true,
+	"strict_email":       true,
+	"email_domain":       true,
+	"min_age":            true,
+	"pattern":            true,
+}
+
+// knownValidationFields are the request field paths failures are labeled with
+var knownValidationFields = schemaFieldPaths("", models.CreateUserRequestSchema())
+
+// schemaFieldPaths flattens a schema into dotted JSON field paths
+func schemaFieldPaths(prefix string, fields []models.FieldSchema) map[string]bool {
+	paths := make(map[string]bool)
+	for _, field := range fields {
+		path := prefix + field.Name
+		paths[path] = true
+		for nested := range schemaFieldPaths(path+".", field.Fields) {
+			paths[nested] = true
+		}
+	}
+	return paths
+}
+
+// validationFailureCounter counts validation failures by field and tag
+type validationFailureCounter struct {
+	mutex  sync.Mutex
+	counts map[string]int64
+}
+
+// newValidationFailureCounter creates an empty counter
+func newValidationFailureCounter() *validationFailureCounter {
+	return &validationFailureCounter{counts: make(map[string]int64)}
+}
+
+// add increments the count for each label
+func (c *validationFailureCounter) add(labels []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, label := range labels {
+		c.counts[label]++
+	}
+}
+
+// snapshot returns a copy of the counts
+func (c *validationFailureCounter) snapshot() map[string]int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	counts := make(map[string]int64, len(c.counts))
+	for label, count := range c.counts {
+		counts[label] = count
+	}
+	return counts
+}
+
+// boundedLabel returns value when it is known, or "other" so labels stay bounded
+func boundedLabel(value string, known map[string]bool) string {
+	if known[value] {
+		return value
+	}
+	return otherLabel
+}
+
+// recordValidationFailure records the failed tags and field:tag labels of a validation
+// error on the span and in the failure counts
+func (s *UserService) recordValidationFailure(span trace.Span, err error) {
+	tags, labels, ok := s.countValidationFailure(err)
+	if !ok {
+		return
+	}
+	tracing.AddSpanAttributes(span,
+		attribute.StringSlice("validation.failed_tags", tags),
+		attribute.StringSlice("validation.failed_fields", labels),
+	)
+}
+
+// recordItemValidationFailure records a validation error of one batch item as a span
+// event, so the failures of every item in the batch stay on the shared span
+func (s *UserService) recordItemValidationFailure(span trace.Span, index int, err error) {
+	tags, labels, ok := s.countValidationFailure(err)
+	if !ok {
+		return
+	}
+	tracing.AddSpanEvent(span, "validation.failed",
+		attribute.Int("batch.index", index),
+		attribute.StringSlice("validation.failed_tags", tags),
+		attribute.StringSlice("validation.failed_fields", labels),
+	)
+}
+
+// countValidationFailure adds a validation error to the failure counts, returning its
+// sorted tags and field:tag labels, or false if it has no field errors
+func (s *UserService) countValidationFailure(err error) ([]string, []string, bool) {
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Fields) == 0 {
+		return nil, nil, false
+	}
+
+	tagSet := make(map[string]bool)
+	labels := make([]string, 0, len(validationErr.Fields))
+	for _, fieldErr := range validationErr.Fields {
+		tag := boundedLabel(fieldErr.Tag, knownValidationTags)
+		labels = append(labels, boundedLabel(fieldErr.Field, knownValidationFields)+":"+tag)
+		tagSet[tag] = true
+	}
+	s.validationFailures.add(labels)
+
+	tags := make([]string, 0, len(tagSet))
+	for tag := range tagSet {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	sort.Strings(labels)
+	return tags, labels, true
+}
+
+// ValidationFailureCounts returns validation failure counts keyed by "field:tag"
+func (s *UserService) ValidationFailureCounts() map[string]int64 {
+	return s.validationFailures.snapshot()
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"user-api/models"
+)
+
+// Limits on config-provided validation rules
+const (
+	maxValidationRules   = 20
+	maxRulePatternLength = 256
+)
+
+// ValidationRule is a config-provided regex rule applied to a CreateUserRequest field
+type ValidationRule struct {
+	Field   string `json:"field"`
+	Pattern string `json:"pattern"`
+	Message string `json:"message"`
+}
+
+// compiledRule is a validation rule with its pattern compiled
+type compiledRule struct {
+	field   string
+	pattern *regexp.Regexp
+	message string
+}
+
+// ParseValidationRules parses a JSON array of validation rules
+func ParseValidationRules(data string) ([]ValidationRule, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+
+	var rules []ValidationRule
+	if err := json.Unmarshal([]byte(data), &rules); err != nil {
+		return nil, fmt.Errorf("invalid validation rules: %w", err)
+	}
+	return rules, nil
+}
+
+// compileValidationRules compiles rules up front so bad patterns fail at startup
+func compileValidationRules(rules []ValidationRule) ([]compiledRule, error) {
+	if len(rules) > maxValidationRules {
+		return nil, fmt.Errorf("too many validation rules: %d (max %d)", len(rules), maxValidationRules)
+	}
+
+	compiled := make([]compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		if _, ok := requestFieldValue(models.CreateUserRequest{}, rule.Field); !ok {
+			return nil, fmt.Errorf("validation rule %d: unknown field %q", i, rule.Field)
+		}
+		if rule.Pattern == "" || len(rule.Pattern) > maxRulePatternLength {
+			return nil, fmt.Errorf("validation rule %d: pattern must be 1-%d characters", i, maxRulePatternLength)
+		}
+
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("validation rule %d: invalid pattern: %w", i, err)
+		}
+
+		message := rule.Message
+		if message == "" {
+			message = rule.Field + " is invalid"
+		}
+		compiled = append(compiled, compiledRule{field: rule.Field, pattern: pattern, message: message})
+	}
+	return compiled, nil
+}
+
+// checkValidationRules applies the custom rules to non-empty request fields
+func (s *UserService) checkValidationRules(req models.CreateUserRequest) error {
+	var errorMessages []string
+	var fields []models.FieldError
+	for _, rule := range s.rules {
+		value, _ := requestFieldValue(req, rule.field)
+		if value != "" && !rule.pattern.MatchString(value) {
+			errorMessages = append(errorMessages, rule.message)
+			fields = append(fields, models.FieldError{Field: rule.field, Tag: "pattern", Message: rule.message})
+		}
+	}
+
+	if len(errorMessages) > 0 {
+		return &ValidationError{Message: strings.Join(errorMessages, "; "), Fields: fields}
+	}
+	return nil
+}
+
+// requestFieldValue returns the value of a request field by its JSON name
+func requestFieldValue(req models.CreateUserRequest, field string) (string, bool) {
+	switch field {
+	case "first_name":
+		return req.FirstName, true
+	case "last_name":
+		return req.LastName, true
+	case "email":
+		return req.Email, true
+	case "phone":
+		return req.Phone, true
+	case "date_of_birth":
+		return req.DateOfBirth, true
+	case "locale":
+		return req.Locale, true
+	default:
+		return "", false
+	}
+}
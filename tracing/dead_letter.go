@@ -0,0 +1,120 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DeadLetterExporter wraps a span exporter and, when an export fails, appends the
+// spans as JSON lines to a local file so they can be replayed later
+type DeadLetterExporter struct {
+	primary sdktrace.SpanExporter
+	path    string
+	mutex   sync.Mutex
+}
+
+// NewDeadLetterExporter creates an exporter that falls back to the file at path
+func NewDeadLetterExporter(primary sdktrace.SpanExporter, path string) *DeadLetterExporter {
+	return &DeadLetterExporter{
+		primary: primary,
+		path:    path,
+	}
+}
+
+// ExportSpans exports spans with the primary exporter, writing them to the
+// dead-letter file if that fails
+func (e *DeadLetterExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.primary.ExportSpans(ctx, spans)
+	if err == nil {
+		return nil
+	}
+
+	if writeErr := e.writeDeadLetters(spans); writeErr != nil {
+		return fmt.Errorf("span export failed: %w; dead-letter write failed: %v", err, writeErr)
+	}
+	log.Printf("Span export failed, wrote %d spans to %s: %v", len(spans), e.path, err)
+	return nil
+}
+
+// Shutdown shuts down the primary exporter
+func (e *DeadLetterExporter) Shutdown(ctx context.Context) error {
+	return e.primary.Shutdown(ctx)
+}
+
+// writeDeadLetters appends one JSON line per span to the dead-letter file
+func (e *DeadLetterExporter) writeDeadLetters(spans []sdktrace.ReadOnlySpan) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(e.path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(e.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, span := range spans {
+		if err := encoder.Encode(newDeadLetterSpan(span)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deadLetterSpan is the JSON form of a span in the dead-letter file. Its field names
+// match the SDK's tracetest.SpanStub so existing replay tooling can read either.
+type deadLetterSpan struct {
+	Name                   string
+	SpanContext            trace.SpanContext
+	Parent                 trace.SpanContext
+	SpanKind               trace.SpanKind
+	StartTime              time.Time
+	EndTime                time.Time
+	Attributes             []attribute.KeyValue
+	Events                 []sdktrace.Event
+	Links                  []sdktrace.Link
+	Status                 sdktrace.Status
+	DroppedAttributes      int
+	DroppedEvents          int
+	DroppedLinks           int
+	ChildSpanCount         int
+	Resource               *resource.Resource
+	InstrumentationLibrary instrumentation.Scope
+}
+
+// newDeadLetterSpan copies the fields of span worth replaying
+func newDeadLetterSpan(span sdktrace.ReadOnlySpan) deadLetterSpan {
+	return deadLetterSpan{
+		Name:                   span.Name(),
+		SpanContext:            span.SpanContext(),
+		Parent:                 span.Parent(),
+		SpanKind:               span.SpanKind(),
+		StartTime:              span.StartTime(),
+		EndTime:                span.EndTime(),
+		Attributes:             span.Attributes(),
+		Events:                 span.Events(),
+		Links:                  span.Links(),
+		Status:                 span.Status(),
+		DroppedAttributes:      span.DroppedAttributes(),
+		DroppedEvents:          span.DroppedEvents(),
+		DroppedLinks:           span.DroppedLinks(),
+		ChildSpanCount:         span.ChildSpanCount(),
+		Resource:               span.Resource(),
+		InstrumentationLibrary: span.InstrumentationScope(),
+	}
+}
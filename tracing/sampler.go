@@ -0,0 +1,42 @@
+package tracing
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SamplingPriorityBaggageKey is the baggage member upstream services set to request sampling
+const SamplingPriorityBaggageKey = "sampling.priority"
+
+// baggageSampler forces sampling when the parent context carries a positive
+// sampling.priority baggage member, delegating every other decision
+type baggageSampler struct {
+	delegate sdktrace.Sampler
+}
+
+// NewBaggageSampler wraps delegate so that requests carrying sampling.priority=1
+// (or any positive value) in their baggage are always recorded and sampled
+func NewBaggageSampler(delegate sdktrace.Sampler) sdktrace.Sampler {
+	return baggageSampler{delegate: delegate}
+}
+
+// ShouldSample implements sdktrace.Sampler
+func (s baggageSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	member := baggage.FromContext(p.ParentContext).Member(SamplingPriorityBaggageKey)
+	if priority, err := strconv.Atoi(member.Value()); err == nil && priority > 0 {
+		return sdktrace.SamplingResult{
+			Decision:   sdktrace.RecordAndSample,
+			Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+		}
+	}
+	return s.delegate.ShouldSample(p)
+}
+
+// Description implements sdktrace.Sampler
+func (s baggageSampler) Description() string {
+	return fmt.Sprintf("BaggageSampler{%s}", s.delegate.Description())
+}
@@ -2,10 +2,17 @@ package tracing
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -26,20 +33,51 @@ const (
 
 // TracingConfig holds tracing configuration
 type TracingConfig struct {
-	Enabled      bool
-	ExporterType string // "console", "otlp"
-	OTLPEndpoint string
-	SamplingRate float64
-	Environment  string
+	Enabled         bool
+	ExporterTypes   []string // "console", "otlp"
+	OTLPEndpoint    string
+	SamplingRate    float64
+	Environment     string
+	ResponseHeaders bool      // emit traceparent on responses
+	ConsoleWriter   io.Writer // console exporter output, defaults to stdout
+	AttributeKeys   []string  // attribute keys recorded by AddSpanAttributes; empty allows all
+	DeadLetterPath  string    // file receiving spans the OTLP exporter fails to send; empty disables
+	BaggageSampling bool      // force sampling when baggage carries sampling.priority > 0
+	OTLPInsecure    bool      // send OTLP exports over plain HTTP instead of TLS
+	IgnoredPaths    []string  // request paths that are not traced, e.g. health probes
+	OTLPCACertPath  string    // PEM CA bundle for verifying the collector; empty uses system roots
 }
 
-// InitTracing initializes OpenTelemetry tracing
-func InitTracing(config TracingConfig) (func(context.Context) error, error) {
+// attributeAllowlist holds the keys AddSpanAttributes and AddSpanEvent record (nil allows all)
+var attributeAllowlist map[attribute.Key]bool
+
+// SetAttributeAllowlist restricts AddSpanAttributes and AddSpanEvent to the given keys.
+// An empty list allows all keys.
+func SetAttributeAllowlist(keys []string) {
+	if len(keys) == 0 {
+		attributeAllowlist = nil
+		return
+	}
+	attributeAllowlist = make(map[attribute.Key]bool, len(keys))
+	for _, key := range keys {
+		attributeAllowlist[attribute.Key(key)] = true
+	}
+}
+
+// InitTracing initializes OpenTelemetry tracing with the configured exporters
+// plus any additional exporters supplied by the caller
+func InitTracing(config TracingConfig, extraExporters ...sdktrace.SpanExporter) (func(context.Context) error, error) {
 	if !config.Enabled {
 		log.Println("Tracing is disabled")
 		return func(context.Context) error { return nil }, nil
 	}
 
+	if err := ValidateExporterTypes(config.ExporterTypes); err != nil {
+		return nil, err
+	}
+
+	SetAttributeAllowlist(config.AttributeKeys)
+
 	// Create resource
 	res, err := resource.New(context.Background(),
 		resource.WithAttributes(
@@ -52,35 +90,16 @@ func InitTracing(config TracingConfig) (func(context.Context) error, error) {
 		return nil, fmt.Errorf("failed to create resource: %w", err)
 	}
 
-	// Create exporter based on configuration
-	var exporter sdktrace.SpanExporter
-	switch config.ExporterType {
-	case "console":
-		exporter, err = stdouttrace.New(
-			stdouttrace.WithPrettyPrint(),
-		)
+	// Create exporters based on configuration
+	exporters := make([]sdktrace.SpanExporter, 0, len(config.ExporterTypes)+len(extraExporters))
+	for _, exporterType := range config.ExporterTypes {
+		exporter, err := newExporter(exporterType, config)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create console exporter: %w", err)
-		}
-		log.Println("Using console trace exporter")
-
-	case "otlp":
-		opts := []otlptracehttp.Option{
-			otlptracehttp.WithInsecure(),
-		}
-		if config.OTLPEndpoint != "" {
-			opts = append(opts, otlptracehttp.WithEndpoint(config.OTLPEndpoint))
+			return nil, err
 		}
-
-		exporter, err = otlptracehttp.New(context.Background(), opts...)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
-		}
-		log.Printf("Using OTLP trace exporter with endpoint: %s", config.OTLPEndpoint)
-
-	default:
-		return nil, fmt.Errorf("unsupported exporter type: %s", config.ExporterType)
+		exporters = append(exporters, exporter)
 	}
+	exporters = append(exporters, extraExporters...)
 
 	// Create sampler
 	var sampler sdktrace.Sampler
@@ -91,13 +110,19 @@ func InitTracing(config TracingConfig) (func(context.Context) error, error) {
 	} else {
 		sampler = sdktrace.TraceIDRatioBased(config.SamplingRate)
 	}
+	if config.BaggageSampling {
+		sampler = NewBaggageSampler(sampler)
+	}
 
-	// Create trace provider
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
+	// Create trace provider with a span processor per exporter
+	opts := []sdktrace.TracerProviderOption{
 		sdktrace.WithResource(res),
 		sdktrace.WithSampler(sampler),
-	)
+	}
+	for _, exporter := range exporters {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+	tp := sdktrace.NewTracerProvider(opts...)
 
 	// Set global trace provider
 	otel.SetTracerProvider(tp)
@@ -114,6 +139,158 @@ func InitTracing(config TracingConfig) (func(context.Context) error, error) {
 	return tp.Shutdown, nil
 }
 
+// CheckConnectivity verifies the OTLP collector accepts connections when the OTLP
+// exporter is configured. Other exporters and disabled tracing always pass.
+func CheckConnectivity(ctx context.Context, config TracingConfig) error {
+	if !config.Enabled || !containsString(config.ExporterTypes, "otlp") {
+		return nil
+	}
+
+	address := config.OTLPEndpoint
+	if endpoint, err := url.Parse(config.OTLPEndpoint); err == nil && endpoint.Host != "" {
+		address = endpoint.Host
+		if endpoint.Port() == "" {
+			address = net.JoinHostPort(endpoint.Hostname(), "4318")
+		}
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("OTLP collector unreachable: %w", err)
+	}
+	return conn.Close()
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateExporterTypes checks that each exporter type is supported and listed once
+func ValidateExporterTypes(exporterTypes []string) error {
+	if len(exporterTypes) == 0 {
+		return fmt.Errorf("at least one exporter type is required")
+	}
+
+	seen := make(map[string]bool, len(exporterTypes))
+	for _, exporterType := range exporterTypes {
+		switch exporterType {
+		case "console", "otlp":
+		default:
+			return fmt.Errorf("unsupported exporter type: %s", exporterType)
+		}
+		if seen[exporterType] {
+			return fmt.Errorf("duplicate exporter type: %s", exporterType)
+		}
+		seen[exporterType] = true
+	}
+	return nil
+}
+
+// newExporter creates a span exporter of the given type
+func newExporter(exporterType string, config TracingConfig) (sdktrace.SpanExporter, error) {
+	switch exporterType {
+	case "console":
+		opts := []stdouttrace.Option{
+			stdouttrace.WithPrettyPrint(),
+		}
+		if config.ConsoleWriter != nil {
+			opts = append(opts, stdouttrace.WithWriter(config.ConsoleWriter))
+		}
+
+		exporter, err := stdouttrace.New(opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create console exporter: %w", err)
+		}
+		log.Println("Using console trace exporter")
+		return exporter, nil
+
+	case "otlp":
+		opts, err := otlpOptions(config)
+		if err != nil {
+			return nil, err
+		}
+
+		exporter, err := otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		log.Printf("Using OTLP trace exporter with endpoint: %s", config.OTLPEndpoint)
+
+		if config.DeadLetterPath != "" {
+			log.Printf("Failed OTLP exports will be written to: %s", config.DeadLetterPath)
+			return NewDeadLetterExporter(exporter, config.DeadLetterPath), nil
+		}
+		return exporter, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported exporter type: %s", exporterType)
+	}
+}
+
+// otlpOptions builds the OTLP HTTP exporter options, splitting a URL endpoint into
+// host and path and choosing plain HTTP or TLS (optionally with a custom CA)
+func otlpOptions(config TracingConfig) ([]otlptracehttp.Option, error) {
+	var opts []otlptracehttp.Option
+	if config.OTLPEndpoint != "" {
+		if endpoint, err := url.Parse(config.OTLPEndpoint); err == nil && endpoint.Host != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(endpoint.Host))
+			if endpoint.Path != "" {
+				opts = append(opts, otlptracehttp.WithURLPath(endpoint.Path))
+			}
+		} else {
+			opts = append(opts, otlptracehttp.WithEndpoint(config.OTLPEndpoint))
+		}
+	}
+
+	// A scheme that contradicts the transport setting would fail every export, so refuse it upfront
+	switch endpointScheme(config.OTLPEndpoint) {
+	case "http":
+		if !config.OTLPInsecure {
+			return nil, fmt.Errorf("OTLP endpoint %s uses http but insecure transport is disabled; use https or set TRACING_OTLP_INSECURE=true", config.OTLPEndpoint)
+		}
+	case "https":
+		if config.OTLPInsecure {
+			return nil, fmt.Errorf("OTLP endpoint %s uses https but insecure transport is enabled; use http or set TRACING_OTLP_INSECURE=false", config.OTLPEndpoint)
+		}
+	}
+
+	if config.OTLPInsecure {
+		return append(opts, otlptracehttp.WithInsecure()), nil
+	}
+
+	if config.OTLPCACertPath != "" {
+		pem, err := os.ReadFile(config.OTLPCACertPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read OTLP CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in OTLP CA certificate file %s", config.OTLPCACertPath)
+		}
+		opts = append(opts, otlptracehttp.WithTLSClientConfig(&tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}))
+	}
+	return opts, nil
+}
+
+// endpointScheme returns the lowercased URL scheme of an OTLP endpoint, or "" for a bare host:port
+func endpointScheme(endpoint string) string {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	return strings.ToLower(parsed.Scheme)
+}
+
 // GetTracer returns a tracer for the given name
 func GetTracer(name string) trace.Tracer {
 	return otel.Tracer(name)
@@ -124,14 +301,67 @@ func StartSpan(ctx context.Context, tracer trace.Tracer, spanName string, opts .
 	return tracer.Start(ctx, spanName, opts...)
 }
 
-// AddSpanAttributes adds attributes to a span
+// GoWithContext runs fn in a new goroutine under a span linked to the span in ctx.
+// The goroutine's context keeps ctx's values but not its cancellation, so async work
+// can outlive the request that started it.
+func GoWithContext(ctx context.Context, spanName string, fn func(ctx context.Context)) {
+	parent := trace.SpanContextFromContext(ctx)
+	asyncCtx := context.WithoutCancel(ctx)
+
+	go func() {
+		opts := []trace.SpanStartOption{trace.WithNewRoot()}
+		if parent.IsValid() {
+			opts = append(opts, trace.WithLinks(trace.Link{SpanContext: parent}))
+		}
+
+		ctx, span := StartSpan(asyncCtx, GetTracer("user-api/async"), spanName, opts...)
+		defer span.End()
+
+		fn(ctx)
+	}()
+}
+
+// AddSpanAttributes adds attributes to a span, dropping keys not in the allowlist
 func AddSpanAttributes(span trace.Span, attrs ...attribute.KeyValue) {
-	span.SetAttributes(attrs...)
+	span.SetAttributes(allowedAttributes(attrs)...)
 }
 
-// AddSpanEvent adds an event to a span
+// AddSpanEvent adds an event to a span, dropping attribute keys not in the allowlist
 func AddSpanEvent(span trace.Span, name string, attrs ...attribute.KeyValue) {
-	span.AddEvent(name, trace.WithAttributes(attrs...))
+	span.AddEvent(name, trace.WithAttributes(allowedAttributes(attrs)...))
+}
+
+// allowedAttributes returns the attributes whose keys are in the allowlist
+func allowedAttributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	if attributeAllowlist == nil {
+		return attrs
+	}
+	allowed := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		if attributeAllowlist[attr.Key] {
+			allowed = append(allowed, attr)
+		}
+	}
+	return allowed
+}
+
+// TimedEvent runs fn between "<name>.start" and "<name>.success" or "<name>.failure"
+// events, recording its duration as the "<name>.duration_ms" attribute and any error on the span
+func TimedEvent(span trace.Span, name string, fn func() error) error {
+	AddSpanEvent(span, name+".start")
+	start := time.Now()
+
+	err := fn()
+
+	duration := float64(time.Since(start).Microseconds()) / 1000
+	AddSpanAttributes(span, attribute.Float64(name+".duration_ms", duration))
+	if err != nil {
+		RecordError(span, err)
+		AddSpanEvent(span, name+".failure", AttrErrorMessage.String(err.Error()))
+		return err
+	}
+	AddSpanEvent(span, name+".success")
+	return nil
 }
 
 // RecordError records an error on a span
@@ -158,6 +388,28 @@ func GetSpanID(ctx context.Context) string {
 	return ""
 }
 
+// IsSampled reports whether the span in context is sampled
+func IsSampled(ctx context.Context) bool {
+	return trace.SpanContextFromContext(ctx).IsSampled()
+}
+
+// HTTPResponseAttributes returns the standard response attributes for a status code and
+// body size, flagging 4xx and 5xx responses with http.error and an error type
+func HTTPResponseAttributes(status, size int) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		AttrHTTPStatusCode.Int(status),
+		AttrResponseSize.Int(size),
+		AttrHTTPError.Bool(status >= 400),
+	}
+	if status >= 400 {
+		attrs = append(attrs,
+			AttrErrorType.String("http_error"),
+			AttrErrorMessage.String(fmt.Sprintf("HTTP %d", status)),
+		)
+	}
+	return attrs
+}
+
 // LoadTracingConfigFromEnv loads tracing configuration from environment variables
 func LoadTracingConfigFromEnv(environment string) TracingConfig {
 	config := TracingConfig{
@@ -172,13 +424,21 @@ func LoadTracingConfigFromEnv(environment string) TracingConfig {
 		config.Enabled = environment == "development"
 	}
 
-	// Parse exporter type
-	config.ExporterType = os.Getenv("TRACING_EXPORTER")
-	if config.ExporterType == "" {
+	// Parse exporter types, accepting a single TRACING_EXPORTER for compatibility
+	exporters := os.Getenv("TRACING_EXPORTERS")
+	if exporters == "" {
+		exporters = os.Getenv("TRACING_EXPORTER")
+	}
+	for _, exporterType := range strings.Split(exporters, ",") {
+		if exporterType = strings.TrimSpace(exporterType); exporterType != "" {
+			config.ExporterTypes = append(config.ExporterTypes, exporterType)
+		}
+	}
+	if len(config.ExporterTypes) == 0 {
 		if environment == "development" {
-			config.ExporterType = "console"
+			config.ExporterTypes = []string{"console"}
 		} else {
-			config.ExporterType = "otlp"
+			config.ExporterTypes = []string{"otlp"}
 		}
 	}
 
@@ -188,6 +448,16 @@ func LoadTracingConfigFromEnv(environment string) TracingConfig {
 		config.OTLPEndpoint = "http://localhost:4318/v1/traces"
 	}
 
+	// Parse OTLP transport security. Production always defaults to TLS; elsewhere the
+	// default follows the endpoint's scheme, or plaintext only in development when the
+	// endpoint has no scheme
+	config.OTLPInsecure = environment == "development"
+	if scheme := endpointScheme(config.OTLPEndpoint); scheme != "" && environment != "production" {
+		config.OTLPInsecure = scheme == "http"
+	}
+	config.OTLPInsecure = getEnvBool("TRACING_OTLP_INSECURE", config.OTLPInsecure)
+	config.OTLPCACertPath = os.Getenv("TRACING_OTLP_CA_CERT")
+
 	// Parse sampling rate
 	if samplingStr := os.Getenv("TRACING_SAMPLING_RATE"); samplingStr != "" {
 		if rate, err := strconv.ParseFloat(samplingStr, 64); err == nil {
@@ -203,9 +473,46 @@ func LoadTracingConfigFromEnv(environment string) TracingConfig {
 		}
 	}
 
+	// Parse response header injection flag
+	config.ResponseHeaders = getEnvBool("TRACING_RESPONSE_HEADERS", false)
+
+	// Parse baggage-driven sampling flag
+	config.BaggageSampling = getEnvBool("TRACING_BAGGAGE_SAMPLING", false)
+
+	// Parse dead-letter file for failed OTLP exports
+	config.DeadLetterPath = os.Getenv("TRACING_DEAD_LETTER_FILE")
+
+	// Parse untraced request paths
+	for _, path := range strings.Split(os.Getenv("TRACING_IGNORED_PATHS"), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			config.IgnoredPaths = append(config.IgnoredPaths, path)
+		}
+	}
+
+	// Parse attribute allowlist
+	for _, key := range strings.Split(os.Getenv("TRACING_ATTRIBUTE_ALLOWLIST"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			config.AttributeKeys = append(config.AttributeKeys, key)
+		}
+	}
+
 	return config
 }
 
+// getEnvBool gets a boolean environment variable, logging invalid values and keeping the default
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid value for %s: %q, using default %t", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
 // Common span attribute keys
 var (
 	AttrHTTPMethod     = attribute.Key("http.method")
@@ -217,6 +524,7 @@ var (
 	AttrUserEmail      = attribute.Key("user.email")
 	AttrRequestSize    = attribute.Key("http.request.size")
 	AttrResponseSize   = attribute.Key("http.response.size")
+	AttrHTTPError      = attribute.Key("http.error")
 	AttrErrorType      = attribute.Key("error.type")
 	AttrErrorMessage   = attribute.Key("error.message")
 	AttrDBOperation    = attribute.Key("db.operation")
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultMaxJSONDepth is the default maximum nesting depth of JSON request bodies
+const DefaultMaxJSONDepth = 32
+
+// maxJSONDepth caps the nesting depth of JSON request bodies (0 disables the guard)
+var maxJSONDepth = DefaultMaxJSONDepth
+
+// SetMaxJSONDepth sets the maximum nesting depth of JSON request bodies
+func SetMaxJSONDepth(depth int) {
+	maxJSONDepth = depth
+}
+
+// BindJSON binds the JSON request body into obj, first rejecting bodies nested
+// deeper than the configured limit so pathological payloads never reach the decoder
+func BindJSON(c *gin.Context, obj interface{}) error {
+	if maxJSONDepth > 0 && c.Request.Body != nil {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return err
+		}
+		if err := checkJSONDepth(body, maxJSONDepth); err != nil {
+			return err
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return c.ShouldBindJSON(obj)
+}
+
+// checkJSONDepth walks the JSON tokens and returns an error once nesting exceeds maxDepth
+func checkJSONDepth(body []byte, maxDepth int) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			// io.EOF ends the walk; syntax errors are left for the binder
+			return nil
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			if depth > maxDepth {
+				return fmt.Errorf("request body exceeds maximum JSON nesting depth of %d", maxDepth)
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// List response formats
+const (
+	ListFormatFull = ""
+	ListFormatIDs  = "ids"
+)
+
+// ListParams holds the validated pagination and filter parameters of a list request
+type ListParams struct {
+	Page  int
+	Limit int
+
+	// Format selects the response shape: ListFormatFull or ListFormatIDs
+	Format string
+
+	// ChangedSince restricts results to users updated at or after it; zero means no filter
+	ChangedSince time.Time
+}
+
+// ParseListParams reads and validates the page, limit, format, and changed_since
+// query parameters
+func ParseListParams(c *gin.Context) (ListParams, error) {
+	page, limit, err := ParsePagination(c)
+	if err != nil {
+		return ListParams{}, err
+	}
+
+	params := ListParams{
+		Page:   page,
+		Limit:  limit,
+		Format: c.Query("format"),
+	}
+	if params.Format != ListFormatFull && params.Format != ListFormatIDs {
+		return ListParams{}, errors.New("format must be \"ids\" when provided")
+	}
+
+	if value := c.Query("changed_since"); value != "" {
+		params.ChangedSince, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return ListParams{}, errors.New("changed_since must be an RFC 3339 timestamp, e.g. 2024-01-02T15:04:05Z")
+		}
+		if params.Format == ListFormatIDs {
+			return ListParams{}, errors.New("changed_since cannot be combined with format=ids")
+		}
+	}
+
+	return params, nil
+}
+
+// listParamsKey is the gin context key holding the parsed list parameters
+const listParamsKey = "list_params"
+
+// SetListParams stores parsed list parameters on the context for GetListParams
+func SetListParams(c *gin.Context, params ListParams) {
+	c.Set(listParamsKey, params)
+}
+
+// GetListParams returns the list parameters stored by SetListParams, and false if none were
+func GetListParams(c *gin.Context) (ListParams, bool) {
+	value, ok := c.Get(listParamsKey)
+	if !ok {
+		return ListParams{}, false
+	}
+	params, ok := value.(ListParams)
+	return params, ok
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Pagination defaults
+const (
+	DefaultPage  = 1
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Pagination represents pagination metadata for list responses
+type Pagination struct {
+	Page       int `json:"page"`
+	Limit      int `json:"limit"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+// NewPagination builds pagination metadata for the given total
+func NewPagination(page, limit, total int) *Pagination {
+	totalPages := 0
+	if limit > 0 {
+		totalPages = (total + limit - 1) / limit
+	}
+	return &Pagination{
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: totalPages,
+	}
+}
+
+// PaginationError represents an invalid pagination parameter
+type PaginationError struct {
+	Param   string
+	Message string
+}
+
+// Error implements the error interface
+func (e *PaginationError) Error() string {
+	return e.Param + " " + e.Message
+}
+
+// ParsePagination reads and validates the page and limit query parameters
+func ParsePagination(c *gin.Context) (page, limit int, err error) {
+	page = DefaultPage
+	limit = DefaultLimit
+
+	if pageStr := c.Query("page"); pageStr != "" {
+		page, err = strconv.Atoi(pageStr)
+		if err != nil {
+			return 0, 0, &PaginationError{Param: "page", Message: "must be an integer"}
+		}
+		if page < 1 {
+			return 0, 0, &PaginationError{Param: "page", Message: "must be at least 1"}
+		}
+	}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil {
+			return 0, 0, &PaginationError{Param: "limit", Message: "must be an integer"}
+		}
+		if limit < 1 || limit > MaxLimit {
+			return 0, 0, &PaginationError{Param: "limit", Message: "must be between 1 and " + strconv.Itoa(MaxLimit)}
+		}
+	}
+
+	return page, limit, nil
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"user-api/tracing"
 
@@ -9,11 +11,76 @@ import (
 
 // APIResponse represents a standard API response structure
 type APIResponse struct {
-	Status  string      `json:"status"`
-	Message string      `json:"message,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
-	TraceID string      `json:"trace_id,omitempty"`
+	Status     string      `json:"status"`
+	Message    string      `json:"message,omitempty"`
+	Data       interface{} `json:"data,omitempty"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+	Summary    *Summary    `json:"summary,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	TraceID    string      `json:"trace_id,omitempty"`
+}
+
+// Error response formats
+const (
+	ErrorFormatEnvelope = "envelope"
+	ErrorFormatProblem  = "problem"
+)
+
+// errorFormat controls how error responses are rendered
+var errorFormat = ErrorFormatEnvelope
+
+// SetErrorFormat sets the format used by the error response helpers
+func SetErrorFormat(format string) {
+	if format == ErrorFormatProblem {
+		errorFormat = ErrorFormatProblem
+		return
+	}
+	errorFormat = ErrorFormatEnvelope
+}
+
+// Summary counts item outcomes in a batch response
+type Summary struct {
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+// Batch status modes for responses where some items failed
+const (
+	BatchStatusMultiStatus = "multi_status"
+	BatchStatusOK          = "ok"
+)
+
+// batchStatusMode controls the status code of batch responses with failed items
+var batchStatusMode = BatchStatusMultiStatus
+
+// SetBatchStatusMode sets whether batches with failed items return 207 Multi-Status or 200
+func SetBatchStatusMode(mode string) {
+	if mode == BatchStatusOK {
+		batchStatusMode = BatchStatusOK
+		return
+	}
+	batchStatusMode = BatchStatusMultiStatus
+}
+
+// maxResponseBytes caps the size of serialized success responses (0 disables the guard)
+var maxResponseBytes int
+
+// SetMaxResponseBytes sets the maximum serialized size of success responses
+func SetMaxResponseBytes(limit int) {
+	maxResponseBytes = limit
+}
+
+// ProblemDetails represents an RFC 7807 problem details response
+type ProblemDetails struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	TraceID  string `json:"trace_id,omitempty"`
+
+	// Data is an extension member carrying details such as a failed report
+	Data interface{} `json:"data,omitempty"`
 }
 
 // SuccessResponse sends a successful response
@@ -24,14 +91,48 @@ func SuccessResponse(c *gin.Context, statusCode int, message string, data interf
 		Data:    data,
 		TraceID: tracing.GetTraceID(c.Request.Context()),
 	}
-	c.JSON(statusCode, response)
+	writeGuardedJSON(c, statusCode, response)
+}
+
+// writeGuardedJSON writes the response, replacing it with an error if it exceeds the size limit
+func writeGuardedJSON(c *gin.Context, statusCode int, response APIResponse) {
+	if maxResponseBytes <= 0 {
+		c.JSON(statusCode, response)
+		return
+	}
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		InternalServerErrorResponse(c, "Failed to encode response", err)
+		return
+	}
+
+	if len(body) > maxResponseBytes {
+		err := fmt.Errorf("response of %d bytes exceeds the %d byte limit; use page and limit to request fewer results", len(body), maxResponseBytes)
+		InternalServerErrorResponse(c, "Response too large", err)
+		return
+	}
+
+	c.Data(statusCode, "application/json; charset=utf-8", body)
 }
 
 // ErrorResponse sends an error response
 func ErrorResponse(c *gin.Context, statusCode int, message string, err error) {
+	ErrorResponseWithData(c, statusCode, message, err, nil)
+}
+
+// ErrorResponseWithData sends an error response that also carries data, such as a
+// report of what failed
+func ErrorResponseWithData(c *gin.Context, statusCode int, message string, err error, data interface{}) {
+	if errorFormat == ErrorFormatProblem {
+		problemResponse(c, statusCode, message, err, data)
+		return
+	}
+
 	response := APIResponse{
 		Status:  "error",
 		Message: message,
+		Data:    data,
 		TraceID: tracing.GetTraceID(c.Request.Context()),
 	}
 
@@ -42,6 +143,48 @@ func ErrorResponse(c *gin.Context, statusCode int, message string, err error) {
 	c.JSON(statusCode, response)
 }
 
+// ProblemResponse sends an RFC 7807 application/problem+json error response
+func ProblemResponse(c *gin.Context, statusCode int, message string, err error) {
+	problemResponse(c, statusCode, message, err, nil)
+}
+
+// problemResponse sends a problem details response with optional extension data
+func problemResponse(c *gin.Context, statusCode int, message string, err error, data interface{}) {
+	problem := ProblemDetails{
+		Type:     "about:blank",
+		Title:    statusText(statusCode),
+		Status:   statusCode,
+		Detail:   message,
+		Instance: c.Request.URL.Path,
+		TraceID:  tracing.GetTraceID(c.Request.Context()),
+		Data:     data,
+	}
+
+	if err != nil {
+		problem.Detail = message + ": " + err.Error()
+	}
+
+	c.Header("Content-Type", "application/problem+json")
+	c.JSON(statusCode, problem)
+}
+
+// StatusClientClosedRequest is the non-standard status for requests the client
+// abandoned before a response was written
+const StatusClientClosedRequest = 499
+
+// statusText returns the text for an HTTP status code, including non-standard codes
+func statusText(statusCode int) string {
+	if statusCode == StatusClientClosedRequest {
+		return "Client Closed Request"
+	}
+	return http.StatusText(statusCode)
+}
+
+// ClientClosedResponse sends a client closed request response
+func ClientClosedResponse(c *gin.Context) {
+	ErrorResponse(c, StatusClientClosedRequest, "Client closed request", nil)
+}
+
 // ValidationErrorResponse sends a validation error response
 func ValidationErrorResponse(c *gin.Context, err error) {
 	ErrorResponse(c, http.StatusBadRequest, "Validation failed", err)
@@ -57,6 +200,16 @@ func ConflictResponse(c *gin.Context, message string, err error) {
 	ErrorResponse(c, http.StatusConflict, message, err)
 }
 
+// TooManyRequestsResponse sends a too many requests response
+func TooManyRequestsResponse(c *gin.Context, message string, err error) {
+	ErrorResponse(c, http.StatusTooManyRequests, message, err)
+}
+
+// GatewayTimeoutResponse sends a gateway timeout response
+func GatewayTimeoutResponse(c *gin.Context, message string, err error) {
+	ErrorResponse(c, http.StatusGatewayTimeout, message, err)
+}
+
 // InternalServerErrorResponse sends an internal server error response
 func InternalServerErrorResponse(c *gin.Context, message string, err error) {
 	ErrorResponse(c, http.StatusInternalServerError, message, err)
@@ -71,3 +224,39 @@ func CreatedResponse(c *gin.Context, message string, data interface{}) {
 func OKResponse(c *gin.Context, message string, data interface{}) {
 	SuccessResponse(c, http.StatusOK, message, data)
 }
+
+// MultiStatusResponse sends a batch response with a summary of item outcomes.
+// Batches with failed items return 207 Multi-Status (or 200 when configured), and
+// X-Partial-Success: true is set when some, but not all, items failed.
+func MultiStatusResponse(c *gin.Context, message string, data interface{}, summary Summary) {
+	statusCode := http.StatusOK
+	if summary.Failed > 0 {
+		if batchStatusMode == BatchStatusMultiStatus {
+			statusCode = http.StatusMultiStatus
+		}
+		if summary.Succeeded > 0 {
+			c.Header("X-Partial-Success", "true")
+		}
+	}
+
+	response := APIResponse{
+		Status:  "success",
+		Message: message,
+		Data:    data,
+		Summary: &summary,
+		TraceID: tracing.GetTraceID(c.Request.Context()),
+	}
+	writeGuardedJSON(c, statusCode, response)
+}
+
+// PaginatedResponse sends an OK response with pagination metadata
+func PaginatedResponse(c *gin.Context, message string, data interface{}, pagination *Pagination) {
+	response := APIResponse{
+		Status:     "success",
+		Message:    message,
+		Data:       data,
+		Pagination: pagination,
+		TraceID:    tracing.GetTraceID(c.Request.Context()),
+	}
+	writeGuardedJSON(c, http.StatusOK, response)
+}